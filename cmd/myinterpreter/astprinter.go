@@ -11,32 +11,59 @@ func PrintAst(expr Expr) string {
 	return expr.Accept(&AstPrinter{}).(string)
 }
 
-func (*AstPrinter) VisitAssignExpr(expr Assign) any {
-	return nil
+func (*AstPrinter) VisitAssignExpr(expr *Assign) any {
+	return parenthesize("= "+expr.Name.Lexeme, expr.Value)
 }
 
-func (*AstPrinter) VisitBinaryExpr(expr Binary) any {
+func (*AstPrinter) VisitBinaryExpr(expr *Binary) any {
 	return parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
 }
 
-func (*AstPrinter) VisitGroupingExpr(expr Grouping) any {
+func (*AstPrinter) VisitCallExpr(expr *Call) any {
+	return parenthesize("call", append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (*AstPrinter) VisitConditionalExpr(expr *Conditional) any {
+	return parenthesize("?:", expr.Condition, expr.ThenBranch, expr.ElseBranch)
+}
+
+func (*AstPrinter) VisitGetExpr(expr *Get) any {
+	return parenthesize("."+expr.Name.Lexeme, expr.Object)
+}
+
+func (*AstPrinter) VisitGroupingExpr(expr *Grouping) any {
 	return parenthesize("group", expr.Expression)
 }
 
-func (*AstPrinter) VisitLiteralExpr(expr Literal) any {
+func (*AstPrinter) VisitLambdaExpr(expr *Lambda) any {
+	return "(block)"
+}
+
+func (*AstPrinter) VisitLiteralExpr(expr *Literal) any {
 	return stringify(expr.Value, "nil", true)
 }
 
-func (*AstPrinter) VisitLogicalExpr(expr Logical) any {
-	return nil
+func (*AstPrinter) VisitLogicalExpr(expr *Logical) any {
+	return parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (*AstPrinter) VisitRangeExpr(expr *Range) any {
+	if expr.Step != nil {
+		return parenthesize(expr.Operator.Lexeme, expr.Start, expr.End, expr.Step)
+	}
+	return parenthesize(expr.Operator.Lexeme, expr.Start, expr.End)
+}
+
+func (*AstPrinter) VisitSpawnExpr(expr *Spawn) any {
+	return "(spawn)"
 }
 
-func (*AstPrinter) VisitUnaryExpr(expr Unary) any {
+func (*AstPrinter) VisitUnaryExpr(expr *Unary) any {
 	return parenthesize(expr.Operator.Lexeme, expr.Right)
 }
 
-func (*AstPrinter) VisitVariableExpr(expr Variable) any {
-	return nil
+func (*AstPrinter) VisitVariableExpr(expr *Variable) any {
+	return expr.Name.Lexeme
 }
 
 func parenthesize(name string, exprs ...Expr) string {
@@ -54,15 +81,17 @@ func parenthesize(name string, exprs ...Expr) string {
 }
 
 func Test() {
-	expression := Binary{
-		Unary{
+	expression := &Binary{
+		Node{},
+		&Unary{
+			Node{},
 			Token{
-				MINUS, "-", nil, 1,
+				MINUS, "-", nil, 1, 1, "",
 			},
-			Literal{123},
+			&Literal{Node{}, 123, Token{NUMBER, "123", 123.0, 1, 2, ""}},
 		},
-		Token{STAR, "*", nil, 1},
-		Grouping{Literal{45.67}},
+		Token{STAR, "*", nil, 1, 8, ""},
+		&Grouping{Node{}, &Literal{Node{}, 45.67, Token{NUMBER, "45.67", 45.67, 1, 11, ""}}},
 	}
 
 	printResult := PrintAst(expression)
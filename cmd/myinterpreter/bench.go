@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Runs each script the given number of times with its output discarded, and prints how long a run took.
+// Scripts are parsed once; only running them is timed. Scripts to try it on are in the bench directory.
+func runBenchmarks(filenames []string, runs int) {
+	for _, filename := range filenames {
+		_, parser, statements := parseProgram(readSource(filename))
+		if hadError {
+			os.Exit(exitCompile)
+		}
+		var best, total time.Duration
+		for run := 0; run < runs; run++ {
+			interpreter := NewInterpreter()
+			interpreter.Out = bufio.NewWriter(io.Discard)
+			interpreter.Spans = parser.Spans
+			interpreter.MainFile = filename
+			interpreter.LastId = parser.LastId
+
+			start := time.Now()
+			interpreter.InterpretStatements(statements)
+			elapsed := time.Since(start)
+			if hadRuntimeError || hadHaltError {
+				os.Exit(exitRuntime)
+			}
+			total += elapsed
+			if run == 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		fmt.Printf("%s\t%d runs\tbest %v\tmean %v\n", filename, runs, best.Round(time.Microsecond), (total / time.Duration(runs)).Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"unicode/utf8"
+)
+
+// Implemented by every runtime value that can be called.
+type Callable interface {
+	// The number of arguments a call must pass.
+	Arity() int
+	Call(interpreter *Interpreter, arguments []Value) (Value, error)
+}
+
+// A function implemented in Go and predefined in the global environment.
+type NativeFunction struct {
+	Name     string
+	Params   int
+	Function func(interpreter *Interpreter, arguments []Value) (Value, error)
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.Params
+}
+
+func (n *NativeFunction) Call(interpreter *Interpreter, arguments []Value) (Value, error) {
+	return n.Function(interpreter, arguments)
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn>"
+}
+
+func (n *NativeFunction) Type() string {
+	return "function"
+}
+
+// The value of a block used as an expression, which runs the block in a new scope each time it is called.
+type LoxLambda struct {
+	Declaration *Lambda
+	Closure     *Environment
+}
+
+func (l *LoxLambda) Arity() int {
+	return 0
+}
+
+// Once the block returns, the statement that called it is running again.
+func (l *LoxLambda) Call(interpreter *Interpreter, arguments []Value) (Value, error) {
+	running := interpreter.running
+	err := interpreter.executeBlock(l.Declaration.Body.(*Block).Statements, NewEnvironment(l.Closure)).Err
+	interpreter.running = running
+	return Nil, err
+}
+
+func (l *LoxLambda) String() string {
+	return "<block>"
+}
+
+func (l *LoxLambda) Type() string {
+	return "block"
+}
+
+// Returned by natives, which do not know where they were called from. The interpreter reports it at the call.
+type NativeError string
+
+func (err NativeError) Error() string {
+	return string(err)
+}
+
+// Places an error returned by a native at token, leaving any other error alone.
+func locate(err error, token Token) error {
+	var native NativeError
+	if errors.As(err, &native) {
+		return RuntimeError{token, string(native)}
+	}
+	// Natives that block can be halted without knowing where they were called from either.
+	var halt HaltError
+	if errors.As(err, &halt) && halt.Token.Line == 0 {
+		return HaltError{token, halt.Cause}
+	}
+	return err
+}
+
+func defineNatives(globals *Environment) {
+	for _, native := range []*NativeFunction{
+		{"at", 2, nativeAt},
+		{"channel", 1, nativeChannel},
+		{"clearTimer", 1, nativeClearTimer},
+		{"clock", 0, nativeClock},
+		{"close", 1, nativeClose},
+		{"exit", 1, nativeExit},
+		{"getenv", 1, nativeGetenv},
+		{"len", 1, nativeLen},
+		{"next", 1, nativeNext},
+		{"receive", 1, nativeReceive},
+		{"send", 2, nativeSend},
+		{"setInterval", 2, nativeSetInterval},
+		{"setTimeout", 2, nativeSetTimeout},
+		{"wait", 1, nativeWait},
+	} {
+		globals.define(native.Name, ObjectValue(native))
+	}
+}
+
+// len(value) returns the number of elements of a list, or of characters of a string.
+func nativeLen(interpreter *Interpreter, arguments []Value) (Value, error) {
+	if arguments[0].IsString() {
+		return NumberValue(float64(utf8.RuneCountInString(arguments[0].AsString()))), nil
+	}
+	if list, ok := arguments[0].AsObject().(*List); ok {
+		return NumberValue(float64(len(list.Elements))), nil
+	}
+	return Nil, NativeError("Can only call len() on a list or a string.")
+}
+
+// at(list, index) returns the element of list at index, counting from zero.
+func nativeAt(interpreter *Interpreter, arguments []Value) (Value, error) {
+	list, ok := arguments[0].AsObject().(*List)
+	if !ok {
+		return Nil, NativeError("Can only call at() on a list.")
+	}
+	index := arguments[1].AsNumber()
+	if !arguments[1].IsNumber() || index != math.Trunc(index) {
+		return Nil, NativeError("List index must be an integer.")
+	}
+	if index < 0 || index >= float64(len(list.Elements)) {
+		return Nil, NativeError("List index out of range.")
+	}
+	return list.Elements[int(index)], nil
+}
+
+// getenv(name) returns the value of the environment variable name, or nil if it is not set.
+func nativeGetenv(interpreter *Interpreter, arguments []Value) (Value, error) {
+	if !arguments[0].IsString() {
+		return Nil, NativeError("Environment variable name must be a string.")
+	}
+	value, ok := os.LookupEnv(arguments[0].AsString())
+	if !ok {
+		return Nil, nil
+	}
+	return StringValue(value), nil
+}
+
+// exit(code) unwinds the task it is called from, running finally clauses but no catch clauses, then stops the program,
+// every other task and timer included, and makes the interpreter exit with code.
+func nativeExit(interpreter *Interpreter, arguments []Value) (Value, error) {
+	code := arguments[0].AsNumber()
+	if !arguments[0].IsNumber() || code < 0 || code > 255 || code != math.Trunc(code) {
+		return Nil, NativeError("Exit code must be an integer from 0 to 255.")
+	}
+	return Nil, ExitError{int(code)}
+}
+
+// channel(capacity) creates a channel that holds up to capacity values before send blocks.
+func nativeChannel(interpreter *Interpreter, arguments []Value) (Value, error) {
+	capacity := arguments[0].AsNumber()
+	if !arguments[0].IsNumber() || capacity < 0 || capacity != math.Trunc(capacity) {
+		return Nil, NativeError("Channel capacity must be a non-negative integer.")
+	}
+	return ObjectValue(&Channel{make(chan Value, int(capacity)), interpreter.Runtime}), nil
+}
+
+// close(channel) makes receives return nil once the values already sent have been received.
+func nativeClose(interpreter *Interpreter, arguments []Value) (Value, error) {
+	channel, err := channelArgument("close", arguments[0])
+	if err != nil {
+		return Nil, err
+	}
+	return Nil, channel.close()
+}
+
+// receive(channel) blocks until a value is sent, or returns nil once the channel is closed.
+func nativeReceive(interpreter *Interpreter, arguments []Value) (Value, error) {
+	channel, err := channelArgument("receive", arguments[0])
+	if err != nil {
+		return Nil, err
+	}
+	value, _, err := channel.receive()
+	return value, err
+}
+
+// send(channel, value) blocks until the channel has room for value.
+func nativeSend(interpreter *Interpreter, arguments []Value) (Value, error) {
+	channel, err := channelArgument("send", arguments[0])
+	if err != nil {
+		return Nil, err
+	}
+	return Nil, channel.send(arguments[1])
+}
+
+func channelArgument(native string, value Value) (*Channel, error) {
+	if channel, ok := value.AsObject().(*Channel); ok {
+		return channel, nil
+	}
+	return nil, NativeError("Can only call " + native + "() on a channel.")
+}
+
+// wait(task) blocks until task has finished, and fails with the error the task failed with, if any.
+func nativeWait(interpreter *Interpreter, arguments []Value) (Value, error) {
+	task, ok := arguments[0].AsObject().(*Task)
+	if !ok {
+		return Nil, NativeError("Can only call wait() on a task.")
+	}
+	if err := interpreter.wait(task); err != nil {
+		return Nil, err
+	}
+	task.observed.Store(true)
+	return Nil, task.err
+}
+
+// next(generator) resumes generator and returns the next value it yields, or nil once it has finished.
+func nativeNext(interpreter *Interpreter, arguments []Value) (Value, error) {
+	generator, ok := arguments[0].AsObject().(*GeneratorObject)
+	if !ok {
+		return Nil, NativeError("Can only call next() on a generator.")
+	}
+	value, _, err := generator.Next()
+	return value, err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+)
+
+// How usage messages show the interpreter being run.
+const programName = "./your_program.sh"
+
+// Set when building a release, with -ldflags "-X main.version=...".
+var version = "devel"
+
+// Exit statuses, following the BSD sysexits conventions where they have one.
+const (
+	exitUsage       = 64
+	exitCompile     = 65
+	exitNoInput     = 66
+	exitRuntime     = 70
+	exitHalted      = 75
+	exitInterrupted = 130
+)
+
+type command struct {
+	Name string
+	// What follows the flags on the command line.
+	Args    string
+	Summary string
+	Run     func(c *command, args []string)
+}
+
+var commands = []*command{
+	{"tokenize", "<file>", "Print the tokens of a program.", tokenizeCommand},
+	{"parse", "<file>", "Print the syntax tree of an expression.", parseCommand},
+	{"evaluate", "<file>", "Print the value of an expression.", evaluateCommand},
+	{"run", "<file> [arguments...]", "Run a program. The arguments are in its args list.", runCommand},
+	{"fmt", "<file>", "Print a program formatted.", fmtCommand},
+	{"lint", "<file>", "Report likely mistakes in a program.", lintCommand},
+	{"bench", "<file>...", "Time how long scripts take to run.", benchCommand},
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s <command> [flags] <file>\n\nCommands:\n", programName)
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s%s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> --help' for the flags of a command, or '%s --version' for the version.\n", programName, programName)
+}
+
+func versionString() string {
+	text := "myinterpreter " + version
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				text += " (" + setting.Value[:12] + ")"
+			}
+		}
+	}
+	return text
+}
+
+// Set by the --color flag every command has.
+var color = colorMode("auto")
+
+// Creates the flag set of c. Its usage lists the flags it is given afterwards.
+func (c *command) flags() *flag.FlagSet {
+	flags := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	flags.Var(&color, "color", "when to color diagnostics: auto, always or never. Diagnostics quote the source when stderr is a terminal, or with always")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s %s [flags] %s\n\n%s\n", programName, c.Name, c.Args, c.Summary)
+		if strings.HasPrefix(c.Args, "<file>") && c.Name != "fmt" {
+			fmt.Fprintln(out, "The file is - to read the program from standard input.")
+		}
+		fmt.Fprintln(out, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parses the flags in args. --help prints the usage of c and exits; flags that are not defined are usage errors.
+func (c *command) parse(flags *flag.FlagSet, args []string) {
+	flags.SetOutput(io.Discard)
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		flags.SetOutput(os.Stdout)
+		flags.Usage()
+		os.Exit(0)
+	}
+	if err != nil {
+		c.usageError(err.Error())
+	}
+	setDiagnosticStyle(color)
+}
+
+func (c *command) usageError(message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\nRun '%s %s --help' for usage.\n", c.Name, message, programName, c.Name)
+	os.Exit(exitUsage)
+}
+
+// Parses the flags of a command that only takes a program.
+func (c *command) programFlags(args []string) *flag.FlagSet {
+	flags := c.flags()
+	addInlineFlag(flags)
+	c.parse(flags, args)
+	return flags
+}
+
+func addInlineFlag(flags *flag.FlagSet) {
+	flags.String("e", "", "use this source as the program instead of reading a file")
+}
+
+// Opens the program given to c: the source passed with -e, standard input if the file is "-", or the file.
+// Returns the name of the file, which is empty unless the program is read from one, and the arguments after it,
+// which only run accepts.
+func (c *command) openProgram(flags *flag.FlagSet) (io.ReadCloser, string, []string) {
+	inline := false
+	flags.Visit(func(f *flag.Flag) {
+		inline = inline || f.Name == "e"
+	})
+	arguments := flags.Args()
+	if !inline {
+		if len(arguments) == 0 {
+			c.usageError("missing program file")
+		}
+		arguments = arguments[1:]
+	}
+	if len(arguments) > 0 && c.Name != "run" {
+		c.usageError("unexpected argument " + arguments[0])
+	}
+	if inline {
+		mainName = "<eval>"
+		return io.NopCloser(strings.NewReader(flags.Lookup("e").Value.String())), "", arguments
+	}
+	filename := flags.Arg(0)
+	if filename == "-" {
+		mainName = "<stdin>"
+		return io.NopCloser(os.Stdin), "", arguments
+	}
+	mainFile = filename
+	return openSource(filename), filename, arguments
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How long every thread has to stay blocked, without any channel operation completing, to count as a deadlock.
+// Without it a thread that was just woken up, but has not marked itself as running again, could look blocked.
+const deadlockGrace = 50 * time.Millisecond
+
+// Keeps track of the threads of a program, the main one plus one per running task, to notice when all of them are
+// blocked on each other. The zero value is ready to use.
+type scheduler struct {
+	lock sync.Mutex
+	// Tasks that have not finished yet, and threads waiting in a blocking operation.
+	live    int
+	blocked int
+	// Counts completed blocking operations, so a deadlock check can tell whether anything happened meanwhile.
+	epoch    int
+	checking bool
+	// Closed once a deadlock is found, which fails every blocked operation.
+	deadlock   chan struct{}
+	deadlocked bool
+	// Every task spawned so far, in order.
+	tasks []*Task
+}
+
+// Must be called with the lock held.
+func (s *scheduler) deadlockChannel() chan struct{} {
+	if s.deadlock == nil {
+		s.deadlock = make(chan struct{})
+	}
+	return s.deadlock
+}
+
+// Starts a deadlock check when every thread is blocked. Must be called with the lock held.
+func (s *scheduler) check() {
+	if s.blocked < s.live+1 || s.checking || s.deadlocked {
+		return
+	}
+	s.checking = true
+	epoch := s.epoch
+	time.AfterFunc(deadlockGrace, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.checking = false
+		if s.blocked < s.live+1 {
+			return
+		}
+		if s.epoch != epoch {
+			s.check()
+			return
+		}
+		s.deadlocked = true
+		close(s.deadlockChannel())
+	})
+}
+
+// Performs the first ready operation of cases, like reflect.Select, and returns its index.
+// When none is ready and wait is false it returns -1. Otherwise the thread counts as blocked until one is ready, and
+// fails if meanwhile every other thread gets blocked too or the program is stopped.
+func (r *Runtime) block(cases []reflect.SelectCase, wait bool) (chosen int, received Value, ok bool, err error) {
+	defer func() {
+		if recover() != nil {
+			err = NativeError("Send on a closed channel.")
+		}
+	}()
+
+	ready := append(append([]reflect.SelectCase{}, cases...), reflect.SelectCase{Dir: reflect.SelectDefault})
+	chosen, value, ok := reflect.Select(ready)
+	if chosen < len(cases) {
+		return chosen, receivedValue(value), ok, nil
+	}
+	if !wait {
+		return -1, Nil, false, nil
+	}
+
+	r.scheduler.lock.Lock()
+	r.blocked++
+	deadlock := r.deadlockChannel()
+	r.check()
+	r.scheduler.lock.Unlock()
+	defer func() {
+		r.scheduler.lock.Lock()
+		r.blocked--
+		r.epoch++
+		r.scheduler.lock.Unlock()
+	}()
+
+	blocking := append(append([]reflect.SelectCase{}, cases...),
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(deadlock)},
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.Context.Done())},
+	)
+	chosen, value, ok = reflect.Select(blocking)
+	switch chosen {
+	case len(cases):
+		return chosen, Nil, false, NativeError("Deadlock: every task is blocked.")
+	case len(cases) + 1:
+		return chosen, Nil, false, HaltError{Cause: context.Cause(r.Context)}
+	}
+	return chosen, receivedValue(value), ok, nil
+}
+
+// Unwraps a value received from a channel, which is nil when the channel was closed or the case was a send.
+func receivedValue(value reflect.Value) Value {
+	if !value.IsValid() {
+		return Nil
+	}
+	received, _ := value.Interface().(Value)
+	return received
+}
+
+// A block running on its own goroutine, started by a spawn expression.
+type Task struct {
+	Keyword Token
+	done    chan struct{}
+	err     error
+	// Whether someone has waited for the task, and so received its error.
+	observed atomic.Bool
+}
+
+func (t *Task) String() string {
+	return "<task>"
+}
+
+func (t *Task) Type() string {
+	return "task"
+}
+
+// Runs body on a new goroutine, in a child of the current environment.
+func (i *Interpreter) spawn(keyword Token, body *Block) *Task {
+	task := &Task{Keyword: keyword, done: make(chan struct{})}
+	child := &Interpreter{Globals: i.Globals, Runtime: i.Runtime}
+	environment := NewEnvironment(i.Environment)
+
+	i.scheduler.lock.Lock()
+	i.live++
+	i.tasks = append(i.tasks, task)
+	i.scheduler.lock.Unlock()
+
+	go func() {
+		task.err = child.executeBlock(body.Statements, environment).Err
+		i.exited(task.err)
+		close(task.done)
+		i.scheduler.lock.Lock()
+		i.live--
+		i.check()
+		i.scheduler.lock.Unlock()
+	}()
+	return task
+}
+
+// Blocks until task has finished. The error is about waiting, not about how the task ended.
+func (r *Runtime) wait(task *Task) error {
+	_, _, _, err := r.block([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(task.done)}}, true)
+	return err
+}
+
+// Waits for every task, including the ones spawned while waiting, once the top-level statements are done.
+// Returns false when it stops early because a timer was set, which the event loop has to run first.
+// The error is the first one of a task that nobody waited for.
+func (i *Interpreter) waitForTasks() (bool, error) {
+	for index := 0; ; index++ {
+		i.scheduler.lock.Lock()
+		if index == len(i.tasks) {
+			i.scheduler.lock.Unlock()
+			return true, nil
+		}
+		task := i.tasks[index]
+		i.scheduler.lock.Unlock()
+
+		chosen, _, _, err := i.block([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(task.done)},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(i.wakeChannel())},
+		}, true)
+		if err != nil {
+			return false, locate(err, task.Keyword)
+		}
+		if chosen == 1 {
+			return false, nil
+		}
+		if task.err != nil && !task.observed.Load() {
+			return false, task.err
+		}
+	}
+}
+
+// The runtime value created by channel(capacity).
+type Channel struct {
+	ch      chan Value
+	runtime *Runtime
+}
+
+func (c *Channel) String() string {
+	return "<channel>"
+}
+
+func (c *Channel) Type() string {
+	return "channel"
+}
+
+func (c *Channel) send(value Value) error {
+	_, _, _, err := c.runtime.block([]reflect.SelectCase{c.sendCase(value)}, true)
+	return err
+}
+
+// Returns false once the channel is closed and drained.
+func (c *Channel) receive() (Value, bool, error) {
+	_, value, ok, err := c.runtime.block([]reflect.SelectCase{c.receiveCase()}, true)
+	return value, ok, err
+}
+
+func (c *Channel) close() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = NativeError("Channel is already closed.")
+		}
+	}()
+	close(c.ch)
+	return nil
+}
+
+func (c *Channel) sendCase(value Value) reflect.SelectCase {
+	return reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.ch), Send: reflect.ValueOf(value)}
+}
+
+func (c *Channel) receiveCase() reflect.SelectCase {
+	return reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)}
+}
+
+// Looping over a channel receives from it until it is closed.
+func (c *Channel) Iterate() Iterator {
+	return c
+}
+
+func (c *Channel) Next() (Value, bool, error) {
+	return c.receive()
+}
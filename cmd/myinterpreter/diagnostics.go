@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Diagnostics are plain lines like "[line 1] Error at 'x': ...", unless stderr is a terminal. Then they are annotated
+// like rustc does, quoting the source line with the offending token underlined, and colored unless NO_COLOR is set.
+var annotateDiagnostics = false
+var colorDiagnostics = false
+
+// The values of the --color flag.
+type colorMode string
+
+func (m *colorMode) String() string {
+	return string(*m)
+}
+
+func (m *colorMode) Set(value string) error {
+	switch value {
+	case "auto", "always", "never":
+		*m = colorMode(value)
+		return nil
+	}
+	return errors.New("must be auto, always or never")
+}
+
+// Decides how diagnostics are shown, once the flags are parsed. --color=always annotates them even when stderr is not a
+// terminal.
+func setDiagnosticStyle(mode colorMode) {
+	terminal := isTerminal(os.Stderr)
+	annotateDiagnostics = terminal || mode == "always"
+	colorDiagnostics = mode == "always" || mode == "auto" && terminal && os.Getenv("NO_COLOR") == ""
+}
+
+// The name of the file the main program was read from, which annotated diagnostics show.
+var mainFile = ""
+
+// Where to quote every file scanned so far from, by Token.File, when diagnostics are annotated.
+var sources = struct {
+	lock  sync.Mutex
+	files map[string]*source
+}{files: map[string]*source{}}
+
+// Files on disk are read again for the line a diagnostic quotes. Other input, like standard input, cannot be, so it is
+// kept as it is read, along with where each line starts.
+type source struct {
+	path string
+	lock sync.Mutex
+	text bytes.Buffer
+	// The offset each line after the first starts at.
+	lineStarts []int
+}
+
+func (s *source) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for offset, rest := s.text.Len(), p; ; {
+		newline := bytes.IndexByte(rest, '\n')
+		if newline < 0 {
+			break
+		}
+		offset += newline + 1
+		s.lineStarts = append(s.lineStarts, offset)
+		rest = rest[newline+1:]
+	}
+	return s.text.Write(p)
+}
+
+// Returns the text of a line, without its line break.
+func (s *source) line(line int) (string, bool) {
+	if s.path != "" {
+		return readLine(s.path, line)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if line > len(s.lineStarts)+1 {
+		return "", false
+	}
+	start, end := 0, s.text.Len()
+	if line > 1 {
+		start = s.lineStarts[line-2]
+	}
+	if line <= len(s.lineStarts) {
+		end = s.lineStarts[line-1] - 1
+	}
+	return string(s.text.Bytes()[start:end]), true
+}
+
+func readLine(path string, line int) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		text, err := reader.ReadString('\n')
+		if number == line {
+			return strings.TrimSuffix(text, "\n"), true
+		}
+		if err != nil {
+			return "", false
+		}
+	}
+}
+
+// Registers where to quote file from, if diagnostics quote the source.
+func recordSource(reader io.Reader, file string) io.Reader {
+	if !annotateDiagnostics {
+		return reader
+	}
+	recorded := &source{}
+	if f, ok := reader.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			recorded.path = f.Name()
+		}
+	}
+	sources.lock.Lock()
+	sources.files[file] = recorded
+	sources.lock.Unlock()
+	if recorded.path != "" {
+		return reader
+	}
+	return io.TeeReader(reader, recorded)
+}
+
+// Returns the text of a line of file, if it has been read.
+func sourceLine(file string, line int) (string, bool) {
+	sources.lock.Lock()
+	recorded, ok := sources.files[file]
+	sources.lock.Unlock()
+	if !ok || line < 1 {
+		return "", false
+	}
+	text, ok := recorded.line(line)
+	return strings.TrimSuffix(text, "\r"), ok
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorBlue   = "\x1b[1;34m"
+)
+
+func paint(color, text string) string {
+	if !colorDiagnostics {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// Prints an annotated diagnostic about token. severity is "error" or "warning", possibly followed by a code in
+// brackets. Tokens that were not scanned have no column, so only their line is quoted. Tokens spanning lines, like
+// strings, are quoted on the line they start on.
+func annotate(severity string, token Token, message, hint string) {
+	color := colorRed
+	if strings.HasPrefix(severity, "warning") {
+		color = colorYellow
+	}
+	name := token.File
+	if name == "" {
+		name = mainName
+	}
+	if name == "" {
+		name = mainFile
+	}
+
+	line := token.Line - strings.Count(token.Lexeme, "\n")
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s%s\n", paint(color, severity), paint(colorBold, ": "+message))
+	text, ok := sourceLine(token.File, line)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(line)))
+	position := fmt.Sprintf("%s:%d", name, line)
+	if ok && token.Column > 0 {
+		position += fmt.Sprintf(":%d", token.Column)
+	}
+	fmt.Fprintf(&out, "%s%s %s\n", gutter, paint(colorBlue, "-->"), position)
+	if ok {
+		fmt.Fprintf(&out, "%s %s\n", gutter, paint(colorBlue, "|"))
+		fmt.Fprintf(&out, "%s %s\n", paint(colorBlue, fmt.Sprint(line)+" |"), text)
+		if token.Column > 0 {
+			padding, length := underline(text, token)
+			fmt.Fprintf(&out, "%s %s%s\n", gutter, paint(colorBlue, "|"), padding+paint(color, strings.Repeat("^", length)))
+		}
+	}
+	if hint != "" {
+		fmt.Fprintf(&out, "%s %s %s\n", gutter, paint(colorBlue, "="), paint(colorBold, "help:")+" "+hint)
+	}
+	fmt.Fprint(os.Stderr, out.String())
+}
+
+// Returns the whitespace that lines a caret up with token under text, keeping tabs so that it lines up however they
+// are shown, and how many characters of the line the token takes up.
+func underline(text string, token Token) (string, int) {
+	lexeme, _, _ := strings.Cut(token.Lexeme, "\n")
+	prefix := text[:min(token.Column-1, len(text))]
+	padding := []rune(" ")
+	for _, r := range prefix {
+		if r == '\t' {
+			padding = append(padding, '\t')
+		} else {
+			padding = append(padding, ' ')
+		}
+	}
+	return string(padding), max(utf8.RuneCountInString(lexeme), 1)
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns the candidate closest to name, if one is close enough to be a typo of it. Ties go to the earliest candidate.
+func closestName(name string, candidates []string) string {
+	// Allow one edit for every three characters, so that short names are not matched with anything.
+	limit := max(len(name)/3, 1)
+	if limit >= utf8.RuneCountInString(name) {
+		return ""
+	}
+	closest, closestDistance := "", limit+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if distance := editDistance(name, candidate); distance < closestDistance {
+			closest, closestDistance = candidate, distance
+		}
+	}
+	return closest
+}
+
+// Counts the insertions, deletions, substitutions and swaps of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// Three rows of the table are enough, since swaps only look two rows back.
+	previous2, previous, current := make([]int, len(t)+1), make([]int, len(t)+1), make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(t)]
+}
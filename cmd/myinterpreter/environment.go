@@ -1,48 +1,202 @@
 package main
 
+import (
+	"slices"
+	"sync"
+)
+
+// Environments can be shared by spawned tasks, so every access to their variables holds the lock.
 type Environment struct {
 	// The outer scope, or nil if this is the global environment.
 	Enclosing *Environment
-	Values    map[string]any
+	// Local variables, in the slots the resolver gave them. Declarations run in the same order the resolver saw them,
+	// so each one is appended.
+	Values []Value
+	// Global variables, by interned name. Only used in the global environment.
+	globals []global
+	// The global environment this one is nested in, or itself.
+	global *Environment
+	lock   sync.RWMutex
 }
 
-func (e *Environment) get(name Token) (any, error) {
-	// fmt.Printf("getting %s in current scope: (%v)\n", name.Lexeme, e)
-	if value, ok := e.Values[name.Lexeme]; ok {
-		if value == nil {
-			return "nil", nil
-		}
-		return value, nil
+type global struct {
+	value    Value
+	defined  bool
+	constant bool
+}
+
+// Where the resolver found a variable.
+type Binding struct {
+	// Locals are Depth environments out from the current one, at index Slot of its values.
+	// Globals are in the global environment, at the index of their interned name.
+	Local bool
+	Depth int
+	Slot  int
+	// For globals, the locals in scope where the variable is, to suggest in its place if it turns out not to be defined.
+	Locals *localName
+}
+
+// A local the resolver has seen declared, linked to the ones in scope where it was declared, innermost first. Bindings
+// share the list, which is only walked to build an error.
+type localName struct {
+	Name     string
+	Previous *localName
+}
+
+// Global names are interned so that every global environment can keep its variables in a slice, at the same index.
+type internTable struct {
+	lock    sync.Mutex
+	indices map[string]int
+	names   []string
+}
+
+// Index 0 is never declared, so a variable the resolver never saw is undefined.
+var globalNames = &internTable{indices: map[string]int{"": 0}, names: []string{""}}
+
+func (t *internTable) intern(name string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	index, ok := t.indices[name]
+	if !ok {
+		index = len(t.indices)
+		t.indices[name] = index
+		t.names = append(t.names, name)
 	}
+	return index
+}
+
+func (t *internTable) name(index int) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.names[index]
+}
 
-	if e.Enclosing != nil {
-		// fmt.Printf("getting %s in enclosing scope: (%v)\n", name.Lexeme, e.Enclosing)
-		return e.Enclosing.get(name)
+func NewEnvironment(enclosing *Environment) *Environment {
+	environment := &Environment{Enclosing: enclosing}
+	if enclosing == nil {
+		environment.global = environment
+	} else {
+		environment.global = enclosing.global
 	}
+	return environment
+}
 
-	// fmt.Println("could not find " + name.Lexeme)
-	return nil, RuntimeError{name, "Undefined variable '" + name.Lexeme + "'."}
+func (e *Environment) ancestor(depth int) *Environment {
+	environment := e
+	for ; depth > 0; depth-- {
+		environment = environment.Enclosing
+	}
+	return environment
 }
 
-func (e *Environment) assign(name Token, value any) error {
-	// fmt.Println("assigning " + name.Lexeme)
-	if _, ok := e.Values[name.Lexeme]; ok {
-		e.Values[name.Lexeme] = value
-		return nil
+func (e *Environment) get(binding Binding, name Token) (Value, error) {
+	if !binding.Local {
+		return e.global.getGlobal(binding, name)
 	}
+	environment := e.ancestor(binding.Depth)
+	environment.lock.RLock()
+	defer environment.lock.RUnlock()
+	if binding.Slot >= len(environment.Values) {
+		return Nil, e.undefined(binding, name)
+	}
+	return environment.Values[binding.Slot], nil
+}
 
-	if e.Enclosing != nil {
-		return e.Enclosing.assign(name, value)
+// Constants are only checked here for globals, since the resolver catches every assignment to a local constant.
+func (e *Environment) assign(binding Binding, name Token, value Value) error {
+	if !binding.Local {
+		return e.global.assignGlobal(binding, name, value)
+	}
+	environment := e.ancestor(binding.Depth)
+	environment.lock.Lock()
+	defer environment.lock.Unlock()
+	if binding.Slot >= len(environment.Values) {
+		return e.undefined(binding, name)
 	}
+	environment.Values[binding.Slot] = value
+	return nil
+}
 
-	// fmt.Println("could not find " + name.Lexeme)
-	return RuntimeError{name, "Undefined variable '" + name.Lexeme + "'."}
+func (e *Environment) define(name string, value Value) {
+	e.declare(name, value, false)
 }
 
-func (e *Environment) define(name string, value any) {
-	// fmt.Printf("defining %s as: %v\n", name, value)
-	e.Values[name] = value
-	// for k, v := range e.Values {
-	// 	fmt.Printf("%s -> %v\n", k, v)
-	// }
+func (e *Environment) defineConstant(name string, value Value) {
+	e.declare(name, value, true)
+}
+
+func (e *Environment) declare(name string, value Value, constant bool) {
+	if e.Enclosing == nil {
+		e.defineGlobal(globalNames.intern(name), value, constant)
+		return
+	}
+	e.lock.Lock()
+	e.Values = append(e.Values, value)
+	e.lock.Unlock()
+}
+
+// The lock is released before reporting a variable that is not defined, since that reads the globals again.
+func (e *Environment) getGlobal(binding Binding, name Token) (Value, error) {
+	slot := binding.Slot
+	e.lock.RLock()
+	if slot >= len(e.globals) || !e.globals[slot].defined {
+		e.lock.RUnlock()
+		return Nil, e.undefined(binding, name)
+	}
+	value := e.globals[slot].value
+	e.lock.RUnlock()
+	return value, nil
+}
+
+func (e *Environment) assignGlobal(binding Binding, name Token, value Value) error {
+	slot := binding.Slot
+	e.lock.Lock()
+	if slot >= len(e.globals) || !e.globals[slot].defined {
+		e.lock.Unlock()
+		return e.undefined(binding, name)
+	}
+	defer e.lock.Unlock()
+	if e.globals[slot].constant {
+		return RuntimeError{name, "Cannot assign to constant '" + name.Lexeme + "'."}
+	}
+	e.globals[slot].value = value
+	return nil
+}
+
+// Reports a variable that is not defined, suggesting the closest name that is: a local in scope where the variable is,
+// a global, or true, false or nil.
+func (e *Environment) undefined(binding Binding, name Token) error {
+	candidates := []string{}
+	for local := binding.Locals; local != nil; local = local.Previous {
+		candidates = append(candidates, local.Name)
+	}
+	candidates = slices.Concat(candidates, e.global.globalNames(), valueKeywordNames)
+	message := "Undefined variable '" + name.Lexeme + "'."
+	if suggestion := closestName(name.Lexeme, candidates); suggestion != "" {
+		message += " Did you mean '" + suggestion + "'?"
+	}
+	return RuntimeError{name, message}
+}
+
+// Globals can be declared again, which replaces them, constant or not.
+func (e *Environment) defineGlobal(slot int, value Value, constant bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if slot >= len(e.globals) {
+		e.globals = append(e.globals, make([]global, slot+1-len(e.globals))...)
+	}
+	e.globals[slot] = global{value, true, constant}
+}
+
+// The names of the globals defined in the global environment e.
+func (e *Environment) globalNames() []string {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	names := []string{}
+	for slot, global := range e.globals {
+		if global.defined {
+			names = append(names, globalNames.name(slot))
+		}
+	}
+	return names
 }
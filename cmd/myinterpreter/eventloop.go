@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Timers set by setTimeout and setInterval, run by the main thread once the top-level statements are done.
+// The zero value is ready to use.
+type eventLoop struct {
+	timerLock sync.Mutex
+	timers    map[int]*timer
+	// Ids are handed out in order, which also breaks ties between timers due at the same time.
+	lastTimerId int
+	// Set once, the first time the loop needs to know the time.
+	startedAt time.Time
+	// The time on the virtual clock, which only moves when the loop skips ahead to the next timer.
+	virtualNow time.Duration
+	// Woken whenever a timer is set, in case it is due before the one being waited for.
+	wake chan struct{}
+}
+
+type timer struct {
+	id  int
+	due time.Duration
+	// Zero for timers that only run once.
+	interval time.Duration
+	callback Callable
+	// The call that set the timer, where errors in the callback are reported when it cannot tell.
+	token Token
+}
+
+// The time since the program started, on the virtual clock if it is enabled. Must be called with the timer lock held.
+func (r *Runtime) now() time.Duration {
+	if r.VirtualClock {
+		return r.virtualNow
+	}
+	if r.startedAt.IsZero() {
+		r.startedAt = time.Now()
+	}
+	return time.Since(r.startedAt)
+}
+
+func (r *Runtime) setTimer(callback Callable, delay, interval time.Duration, token Token) float64 {
+	r.timerLock.Lock()
+	defer r.timerLock.Unlock()
+	if r.timers == nil {
+		r.timers = make(map[int]*timer)
+	}
+	r.lastTimerId++
+	r.timers[r.lastTimerId] = &timer{r.lastTimerId, r.now() + delay, interval, callback, token}
+	select {
+	case r.wakeChannelLocked() <- struct{}{}:
+	default:
+	}
+	return float64(r.lastTimerId)
+}
+
+func (r *Runtime) wakeChannel() chan struct{} {
+	r.timerLock.Lock()
+	defer r.timerLock.Unlock()
+	return r.wakeChannelLocked()
+}
+
+// Must be called with the timer lock held.
+func (r *Runtime) wakeChannelLocked() chan struct{} {
+	if r.wake == nil {
+		r.wake = make(chan struct{}, 1)
+	}
+	return r.wake
+}
+
+// Returns the timer that is due first, or nil when there are none left. Must be called with the timer lock held.
+func (r *Runtime) nextTimer() *timer {
+	var next *timer
+	for _, t := range r.timers {
+		if next == nil || t.due < next.due || t.due == next.due && t.id < next.id {
+			next = t
+		}
+	}
+	return next
+}
+
+// Runs timer callbacks in the order they are due until no timers are left. An error in a callback ends the loop.
+func (i *Interpreter) runEventLoop() error {
+	for {
+		i.timerLock.Lock()
+		next := i.nextTimer()
+		if next == nil {
+			i.timerLock.Unlock()
+			return nil
+		}
+		wait := next.due - i.now()
+		if wait > 0 && i.VirtualClock {
+			i.virtualNow = next.due
+			wait = 0
+		}
+		if wait <= 0 {
+			if next.interval > 0 {
+				next.due += next.interval
+			} else {
+				delete(i.timers, next.id)
+			}
+		}
+		i.timerLock.Unlock()
+
+		if wait > 0 {
+			// Sleep until the timer is due, then look again since timers may have been set or cleared meanwhile.
+			select {
+			case <-time.After(wait):
+			case <-i.wakeChannel():
+			case <-i.Context.Done():
+				return HaltError{next.token, context.Cause(i.Context)}
+			}
+			continue
+		}
+		if _, err := next.callback.Call(i, []Value{}); err != nil {
+			return locate(err, next.token)
+		}
+	}
+}
+
+func (r *Runtime) hasTimers() bool {
+	r.timerLock.Lock()
+	defer r.timerLock.Unlock()
+	return len(r.timers) > 0
+}
+
+// setTimeout(callback, milliseconds) calls callback once, after the top-level statements are done and at least
+// milliseconds have passed. Returns the id to pass to clearTimer.
+func nativeSetTimeout(interpreter *Interpreter, arguments []Value) (Value, error) {
+	callback, delay, err := timerArguments("setTimeout", arguments)
+	if err != nil {
+		return Nil, err
+	}
+	return NumberValue(interpreter.setTimer(callback, delay, 0, interpreter.callToken)), nil
+}
+
+// setInterval(callback, milliseconds) calls callback every milliseconds until the timer is cleared.
+func nativeSetInterval(interpreter *Interpreter, arguments []Value) (Value, error) {
+	callback, interval, err := timerArguments("setInterval", arguments)
+	if err != nil {
+		return Nil, err
+	}
+	if interval <= 0 {
+		return Nil, NativeError("Interval must be greater than zero.")
+	}
+	return NumberValue(interpreter.setTimer(callback, interval, interval, interpreter.callToken)), nil
+}
+
+func timerArguments(native string, arguments []Value) (Callable, time.Duration, error) {
+	callback, ok := arguments[0].AsObject().(Callable)
+	if !ok || callback.Arity() != 0 {
+		return nil, 0, NativeError("The first argument of " + native + "() must be a block or a function without parameters.")
+	}
+	milliseconds := arguments[1].AsNumber()
+	if !arguments[1].IsNumber() || milliseconds < 0 || math.IsNaN(milliseconds) {
+		return nil, 0, NativeError("The delay of " + native + "() must be a non-negative number of milliseconds.")
+	}
+	return callback, time.Duration(milliseconds * float64(time.Millisecond)), nil
+}
+
+// clearTimer(id) stops a timer from running again. Clearing a timer that already finished does nothing.
+func nativeClearTimer(interpreter *Interpreter, arguments []Value) (Value, error) {
+	id := arguments[0].AsNumber()
+	if !arguments[0].IsNumber() {
+		return Nil, NativeError("Timer id must be a number.")
+	}
+	interpreter.timerLock.Lock()
+	defer interpreter.timerLock.Unlock()
+	delete(interpreter.timers, int(id))
+	return Nil, nil
+}
+
+// clock() returns the current time in seconds, or the seconds since the program started on the virtual clock.
+func nativeClock(interpreter *Interpreter, arguments []Value) (Value, error) {
+	if !interpreter.VirtualClock {
+		return NumberValue(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+	}
+	interpreter.timerLock.Lock()
+	defer interpreter.timerLock.Unlock()
+	return NumberValue(interpreter.now().Seconds()), nil
+}
@@ -2,77 +2,206 @@ package main
 
 type Expr interface {
 	Accept(visitor ExprVisitor) any
+	NodeId() int
 }
 
 type ExprVisitor interface {
-	VisitAssignExpr(expr Assign) any
-	VisitBinaryExpr(expr Binary) any
-	VisitGroupingExpr(expr Grouping) any
-	VisitLiteralExpr(expr Literal) any
-	VisitLogicalExpr(expr Logical) any
-	VisitUnaryExpr(expr Unary) any
-	VisitVariableExpr(expr Variable) any
+	VisitAssignExpr(expr *Assign) any
+	VisitBinaryExpr(expr *Binary) any
+	VisitCallExpr(expr *Call) any
+	VisitConditionalExpr(expr *Conditional) any
+	VisitGetExpr(expr *Get) any
+	VisitGroupingExpr(expr *Grouping) any
+	VisitLambdaExpr(expr *Lambda) any
+	VisitLiteralExpr(expr *Literal) any
+	VisitLogicalExpr(expr *Logical) any
+	VisitRangeExpr(expr *Range) any
+	VisitSpawnExpr(expr *Spawn) any
+	VisitUnaryExpr(expr *Unary) any
+	VisitVariableExpr(expr *Variable) any
+}
+
+type TypedExprVisitor[T any] interface {
+	VisitAssignExpr(expr *Assign) T
+	VisitBinaryExpr(expr *Binary) T
+	VisitCallExpr(expr *Call) T
+	VisitConditionalExpr(expr *Conditional) T
+	VisitGetExpr(expr *Get) T
+	VisitGroupingExpr(expr *Grouping) T
+	VisitLambdaExpr(expr *Lambda) T
+	VisitLiteralExpr(expr *Literal) T
+	VisitLogicalExpr(expr *Logical) T
+	VisitRangeExpr(expr *Range) T
+	VisitSpawnExpr(expr *Spawn) T
+	VisitUnaryExpr(expr *Unary) T
+	VisitVariableExpr(expr *Variable) T
+}
+
+func AcceptExpr[T any](expr Expr, visitor TypedExprVisitor[T]) T {
+	switch t := expr.(type) {
+	case *Assign:
+		return visitor.VisitAssignExpr(t)
+	case *Binary:
+		return visitor.VisitBinaryExpr(t)
+	case *Call:
+		return visitor.VisitCallExpr(t)
+	case *Conditional:
+		return visitor.VisitConditionalExpr(t)
+	case *Get:
+		return visitor.VisitGetExpr(t)
+	case *Grouping:
+		return visitor.VisitGroupingExpr(t)
+	case *Lambda:
+		return visitor.VisitLambdaExpr(t)
+	case *Literal:
+		return visitor.VisitLiteralExpr(t)
+	case *Logical:
+		return visitor.VisitLogicalExpr(t)
+	case *Range:
+		return visitor.VisitRangeExpr(t)
+	case *Spawn:
+		return visitor.VisitSpawnExpr(t)
+	case *Unary:
+		return visitor.VisitUnaryExpr(t)
+	case *Variable:
+		return visitor.VisitVariableExpr(t)
+	}
+	panic("unknown Expr")
 }
 
 type Assign struct {
+	Node
 	Name Token
 	Value Expr
+	Binding Binding
 }
 
-func (t Assign) Accept(visitor ExprVisitor) any {
+func (t *Assign) Accept(visitor ExprVisitor) any {
 	return visitor.VisitAssignExpr(t)
 }
 
 type Binary struct {
+	Node
 	Left Expr
 	Operator Token
 	Right Expr
 }
 
-func (t Binary) Accept(visitor ExprVisitor) any {
+func (t *Binary) Accept(visitor ExprVisitor) any {
 	return visitor.VisitBinaryExpr(t)
 }
 
+type Call struct {
+	Node
+	Callee Expr
+	Paren Token
+	Arguments []Expr
+}
+
+func (t *Call) Accept(visitor ExprVisitor) any {
+	return visitor.VisitCallExpr(t)
+}
+
+type Conditional struct {
+	Node
+	Condition Expr
+	Operator Token
+	ThenBranch Expr
+	ElseBranch Expr
+}
+
+func (t *Conditional) Accept(visitor ExprVisitor) any {
+	return visitor.VisitConditionalExpr(t)
+}
+
+type Get struct {
+	Node
+	Object Expr
+	Name Token
+}
+
+func (t *Get) Accept(visitor ExprVisitor) any {
+	return visitor.VisitGetExpr(t)
+}
+
 type Grouping struct {
+	Node
 	Expression Expr
 }
 
-func (t Grouping) Accept(visitor ExprVisitor) any {
+func (t *Grouping) Accept(visitor ExprVisitor) any {
 	return visitor.VisitGroupingExpr(t)
 }
 
+type Lambda struct {
+	Node
+	Body Stmt
+}
+
+func (t *Lambda) Accept(visitor ExprVisitor) any {
+	return visitor.VisitLambdaExpr(t)
+}
+
 type Literal struct {
+	Node
 	Value any
+	Token Token
 }
 
-func (t Literal) Accept(visitor ExprVisitor) any {
+func (t *Literal) Accept(visitor ExprVisitor) any {
 	return visitor.VisitLiteralExpr(t)
 }
 
 type Logical struct {
+	Node
 	Left Expr
 	Operator Token
 	Right Expr
 }
 
-func (t Logical) Accept(visitor ExprVisitor) any {
+func (t *Logical) Accept(visitor ExprVisitor) any {
 	return visitor.VisitLogicalExpr(t)
 }
 
+type Range struct {
+	Node
+	Start Expr
+	Operator Token
+	End Expr
+	Step Expr
+}
+
+func (t *Range) Accept(visitor ExprVisitor) any {
+	return visitor.VisitRangeExpr(t)
+}
+
+type Spawn struct {
+	Node
+	Keyword Token
+	Body Stmt
+}
+
+func (t *Spawn) Accept(visitor ExprVisitor) any {
+	return visitor.VisitSpawnExpr(t)
+}
+
 type Unary struct {
+	Node
 	Operator Token
 	Right Expr
 }
 
-func (t Unary) Accept(visitor ExprVisitor) any {
+func (t *Unary) Accept(visitor ExprVisitor) any {
 	return visitor.VisitUnaryExpr(t)
 }
 
 type Variable struct {
+	Node
 	Name Token
+	Binding Binding
 }
 
-func (t Variable) Accept(visitor ExprVisitor) any {
+func (t *Variable) Accept(visitor ExprVisitor) any {
 	return visitor.VisitVariableExpr(t)
 }
 
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const indentUnit = "  "
+
+// Re-emits a parsed program in the canonical style.
+// Statements are written as whole lines; expressions are rendered by the ExprVisitor methods.
+type Formatter struct {
+	Spans    map[int]Span
+	Comments []Comment
+	// Index of the next comment that has not been written yet.
+	NextComment int
+	// The source line of the last thing written, used to keep intentional blank lines.
+	LastLine int
+	Depth    int
+	sb       strings.Builder
+}
+
+// Formats statements along with the comments that surrounded them in the source.
+func Format(statements []Stmt, spans map[int]Span, comments []Comment) string {
+	f := &Formatter{Spans: spans, Comments: comments}
+	for _, statement := range statements {
+		f.statement(statement)
+	}
+	f.commentsBefore(-1)
+	return f.sb.String()
+}
+
+// Formats statements without comments or blank lines, which only depends on the shape of the AST.
+func formatCanonical(statements []Stmt) string {
+	f := &Formatter{}
+	for _, statement := range statements {
+		f.statement(statement)
+	}
+	return f.sb.String()
+}
+
+// Formats a whole source file, then makes sure the result parses to the same AST, keeps every comment
+// and is left unchanged by formatting it again.
+func formatSource(source string) (string, error) {
+	scanner, parser, statements := parseProgram(source)
+	if hadError {
+		return "", nil
+	}
+	formatted := Format(statements, parser.Spans, scanner.Comments)
+
+	reformattedScanner, reformattedParser, reformatted := parseProgram(formatted)
+	if hadError || formatCanonical(reformatted) != formatCanonical(statements) {
+		return "", errors.New("formatting changed the meaning of the program")
+	}
+	if len(reformattedScanner.Comments) != len(scanner.Comments) {
+		return "", errors.New("formatting lost comments")
+	}
+	if Format(reformatted, reformattedParser.Spans, reformattedScanner.Comments) != formatted {
+		return "", errors.New("formatting is not idempotent")
+	}
+	return formatted, nil
+}
+
+func (f *Formatter) statement(stmt Stmt) {
+	span, hasSpan := f.Spans[stmt.NodeId()]
+	if hasSpan {
+		f.commentsBefore(span.Start.Line)
+		f.blankLineBefore(span.Start.Line)
+	}
+	f.indent()
+	start := f.sb.Len()
+	stmt.Accept(f)
+	if hasSpan {
+		f.commentsInside(start, span.End.Line)
+		f.trailingComment(span.End.Line)
+		f.LastLine = span.End.Line
+	}
+	f.endLine()
+}
+
+// Writes every pending comment that starts before line, or all of them when line is negative.
+func (f *Formatter) commentsBefore(line int) {
+	for f.NextComment < len(f.Comments) {
+		comment := f.Comments[f.NextComment]
+		if line >= 0 && comment.Line >= line {
+			return
+		}
+		f.blankLineBefore(comment.Line)
+		f.indent()
+		f.sb.WriteString(strings.TrimRight(comment.Text, " \t\r"))
+		f.endLine()
+		f.LastLine = comment.Line
+		f.NextComment++
+	}
+}
+
+// Comments inside a statement that nothing in it was written with, like one between the arguments of a call, are
+// moved to the lines before it rather than after it. start is where the statement begins in the output.
+func (f *Formatter) commentsInside(start, endLine int) {
+	lines := ""
+	for f.NextComment < len(f.Comments) && f.Comments[f.NextComment].Line < endLine {
+		lines += strings.TrimRight(f.Comments[f.NextComment].Text, " \t\r") + "\n" + strings.Repeat(indentUnit, f.Depth)
+		f.NextComment++
+	}
+	if lines == "" {
+		return
+	}
+	s := f.sb.String()
+	f.sb.Reset()
+	f.sb.WriteString(s[:start] + lines + s[start:])
+}
+
+// Returns what follows operator in an expression: a space, or, when the operand after it starts on a later line and a
+// comment follows it, the comment and a line break, continuing the expression one level deeper.
+func (f *Formatter) afterOperator(operator Token, operand Expr) string {
+	next := exprToken(operand)
+	if f.NextComment < len(f.Comments) && operator.Line > 0 && next.Line > operator.Line &&
+		f.Comments[f.NextComment].Line == operator.Line {
+		comment := strings.TrimRight(f.Comments[f.NextComment].Text, " \t\r")
+		f.NextComment++
+		return " " + comment + "\n" + strings.Repeat(indentUnit, f.Depth+1)
+	}
+	return " "
+}
+
+func (f *Formatter) trailingComment(line int) {
+	if strings.HasSuffix(f.sb.String(), "\n") {
+		return
+	}
+	if f.NextComment < len(f.Comments) && f.Comments[f.NextComment].Line == line {
+		f.sb.WriteString(" " + strings.TrimRight(f.Comments[f.NextComment].Text, " \t\r"))
+		f.NextComment++
+	}
+}
+
+// Keeps at most one blank line where the source had any, except right after an opening brace.
+func (f *Formatter) blankLineBefore(line int) {
+	if f.LastLine > 0 && line > f.LastLine+1 {
+		f.sb.WriteRune('\n')
+	}
+}
+
+func (f *Formatter) indent() {
+	f.sb.WriteString(strings.Repeat(indentUnit, f.Depth))
+}
+
+func (f *Formatter) endLine() {
+	s := f.sb.String()
+	if len(s) > 0 && s[len(s)-1] != '\n' {
+		f.sb.WriteRune('\n')
+	}
+}
+
+// Writes the body of an if, while or for: blocks open on the same line, anything else is indented on the next.
+func (f *Formatter) body(stmt Stmt) {
+	if block, ok := stmt.(*Block); ok {
+		f.sb.WriteRune(' ')
+		f.VisitBlockStmt(block)
+		return
+	}
+	f.endLine()
+	f.LastLine = 0
+	f.Depth++
+	f.statement(stmt)
+	f.Depth--
+}
+
+func (f *Formatter) expr(expr Expr) string {
+	return expr.Accept(f).(string)
+}
+
+func (f *Formatter) VisitBlockStmt(stmt *Block) any {
+	if len(stmt.Statements) == 0 {
+		f.sb.WriteString("{}")
+		return nil
+	}
+	f.sb.WriteString("{\n")
+	f.LastLine = 0
+	f.Depth++
+	for _, statement := range stmt.Statements {
+		f.statement(statement)
+	}
+	if span, ok := f.Spans[stmt.NodeId()]; ok {
+		f.commentsBefore(span.End.Line)
+	}
+	f.Depth--
+	f.indent()
+	f.sb.WriteRune('}')
+	return nil
+}
+
+func (f *Formatter) VisitExportStmt(stmt *Export) any {
+	f.sb.WriteString("export ")
+	stmt.Declaration.Accept(f)
+	return nil
+}
+
+func (f *Formatter) VisitExpressionStmt(stmt *Expression) any {
+	f.sb.WriteString(f.expr(stmt.Expression) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitForStmt(stmt *For) any {
+	f.sb.WriteString("for (")
+	switch initializer := stmt.Initializer.(type) {
+	case nil:
+		f.sb.WriteRune(';')
+	default:
+		initializer.Accept(f)
+	}
+	if stmt.Condition != nil {
+		f.sb.WriteString(" " + f.expr(stmt.Condition))
+	}
+	f.sb.WriteRune(';')
+	if stmt.Increment != nil {
+		f.sb.WriteString(" " + f.expr(stmt.Increment))
+	}
+	f.sb.WriteRune(')')
+	f.body(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitForInStmt(stmt *ForIn) any {
+	f.sb.WriteString("for (var " + stmt.Name.Lexeme + " in " + f.expr(stmt.Iterable) + ")")
+	f.body(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitGeneratorStmt(stmt *Generator) any {
+	params := []string{}
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	f.sb.WriteString("fun* " + stmt.Name.Lexeme + "(" + strings.Join(params, ", ") + ")")
+	f.body(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitIfStmt(stmt *If) any {
+	f.sb.WriteString("if (" + f.expr(stmt.Condition) + ")")
+	f.body(stmt.ThenBranch)
+	if stmt.ElseBranch == nil {
+		return nil
+	}
+	if _, ok := stmt.ThenBranch.(*Block); ok {
+		f.sb.WriteRune(' ')
+	} else {
+		f.indent()
+	}
+	f.sb.WriteString("else")
+	if elseIf, ok := stmt.ElseBranch.(*If); ok {
+		f.sb.WriteRune(' ')
+		f.VisitIfStmt(elseIf)
+		return nil
+	}
+	f.body(stmt.ElseBranch)
+	return nil
+}
+
+func (f *Formatter) VisitImportStmt(stmt *Import) any {
+	f.sb.WriteString("import " + stmt.Path.Lexeme + " as " + stmt.Name.Lexeme + ";")
+	return nil
+}
+
+func (f *Formatter) VisitMatchStmt(stmt *Match) any {
+	f.sb.WriteString("match (" + f.expr(stmt.Subject) + ") {\n")
+	f.LastLine = 0
+	f.Depth++
+	for _, matchCase := range stmt.Cases {
+		patterns := []string{}
+		for _, pattern := range matchCase.Patterns {
+			text := f.expr(pattern.Value)
+			if pattern.End != nil {
+				text += pattern.Operator.Lexeme + f.expr(pattern.End)
+			}
+			patterns = append(patterns, text)
+		}
+		f.caseBody("case "+strings.Join(patterns, ", ")+":", matchCase.Body)
+	}
+	if stmt.Default != nil {
+		f.caseBody("default:", stmt.Default)
+	}
+	if span, ok := f.Spans[stmt.NodeId()]; ok {
+		f.commentsBefore(span.End.Line)
+	}
+	f.Depth--
+	f.indent()
+	f.sb.WriteRune('}')
+	return nil
+}
+
+func (f *Formatter) VisitSelectStmt(stmt *Select) any {
+	f.sb.WriteString("select {\n")
+	f.LastLine = 0
+	f.Depth++
+	for _, selectCase := range stmt.Cases {
+		label := "case "
+		if selectCase.Name.Lexeme != "" {
+			label += "var " + selectCase.Name.Lexeme + " = "
+		}
+		label += selectCase.Operation.Lexeme + "(" + f.expr(selectCase.Channel)
+		if selectCase.Value != nil {
+			label += ", " + f.expr(selectCase.Value)
+		}
+		f.caseBody(label+"):", selectCase.Body)
+	}
+	if stmt.Default != nil {
+		f.caseBody("default:", stmt.Default)
+	}
+	if span, ok := f.Spans[stmt.NodeId()]; ok {
+		f.commentsBefore(span.End.Line)
+	}
+	f.Depth--
+	f.indent()
+	f.sb.WriteRune('}')
+	return nil
+}
+
+func (f *Formatter) caseBody(label string, body Stmt) {
+	f.indent()
+	f.sb.WriteString(label)
+	f.endLine()
+	f.LastLine = 0
+	f.Depth++
+	for _, statement := range body.(*Block).Statements {
+		f.statement(statement)
+	}
+	f.Depth--
+}
+
+func (f *Formatter) VisitPrintStmt(stmt *Print) any {
+	f.sb.WriteString("print " + f.expr(stmt.Expression) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitThrowStmt(stmt *Throw) any {
+	f.sb.WriteString("throw " + f.expr(stmt.Value) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitTryStmt(stmt *Try) any {
+	f.sb.WriteString("try")
+	f.body(stmt.Body)
+	if stmt.CatchBody != nil {
+		f.sb.WriteString(" catch (" + stmt.CatchName.Lexeme + ")")
+		f.body(stmt.CatchBody)
+	}
+	if stmt.FinallyBody != nil {
+		f.sb.WriteString(" finally")
+		f.body(stmt.FinallyBody)
+	}
+	return nil
+}
+
+func (f *Formatter) VisitVarStmt(stmt *Var) any {
+	f.sb.WriteString(stmt.Keyword.Lexeme + " " + stmt.Name.Lexeme)
+	if stmt.Initializer != nil {
+		f.sb.WriteString(" = " + f.expr(stmt.Initializer))
+	}
+	f.sb.WriteRune(';')
+	return nil
+}
+
+func (f *Formatter) VisitWhileStmt(stmt *While) any {
+	f.sb.WriteString("while (" + f.expr(stmt.Condition) + ")")
+	f.body(stmt.Body)
+	return nil
+}
+
+func (f *Formatter) VisitYieldStmt(stmt *Yield) any {
+	f.sb.WriteString("yield " + f.expr(stmt.Value) + ";")
+	return nil
+}
+
+func (f *Formatter) VisitAssignExpr(expr *Assign) any {
+	return expr.Name.Lexeme + " = " + f.expr(expr.Value)
+}
+
+func (f *Formatter) VisitBinaryExpr(expr *Binary) any {
+	left := f.expr(expr.Left)
+	return left + " " + expr.Operator.Lexeme + f.afterOperator(expr.Operator, expr.Right) + f.expr(expr.Right)
+}
+
+func (f *Formatter) VisitCallExpr(expr *Call) any {
+	arguments := []string{}
+	for _, argument := range expr.Arguments {
+		arguments = append(arguments, f.expr(argument))
+	}
+	return f.expr(expr.Callee) + "(" + strings.Join(arguments, ", ") + ")"
+}
+
+func (f *Formatter) VisitConditionalExpr(expr *Conditional) any {
+	return f.expr(expr.Condition) + " ? " + f.expr(expr.ThenBranch) + " : " + f.expr(expr.ElseBranch)
+}
+
+func (f *Formatter) VisitGetExpr(expr *Get) any {
+	return f.expr(expr.Object) + "." + expr.Name.Lexeme
+}
+
+func (f *Formatter) VisitGroupingExpr(expr *Grouping) any {
+	return "(" + f.expr(expr.Expression) + ")"
+}
+
+func (f *Formatter) VisitLambdaExpr(expr *Lambda) any {
+	return f.inlineBlock(expr.Body)
+}
+
+func (f *Formatter) VisitLiteralExpr(expr *Literal) any {
+	switch value := expr.Value.(type) {
+	case string:
+		return "\"" + value + "\""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return stringify(value, "nil", false)
+	}
+}
+
+func (f *Formatter) VisitLogicalExpr(expr *Logical) any {
+	left := f.expr(expr.Left)
+	return left + " " + expr.Operator.Lexeme + f.afterOperator(expr.Operator, expr.Right) + f.expr(expr.Right)
+}
+
+func (f *Formatter) VisitRangeExpr(expr *Range) any {
+	text := f.expr(expr.Start) + expr.Operator.Lexeme + f.expr(expr.End)
+	if expr.Step != nil {
+		text += " step " + f.expr(expr.Step)
+	}
+	return text
+}
+
+func (f *Formatter) VisitSpawnExpr(expr *Spawn) any {
+	return "spawn " + f.inlineBlock(expr.Body)
+}
+
+// Blocks inside expressions are written by a formatter of their own, since expressions are returned rather than
+// written. The block continues the line the expression is on, so it is indented like the statement holding it.
+func (f *Formatter) inlineBlock(body Stmt) string {
+	inner := &Formatter{Spans: f.Spans, Comments: f.Comments, NextComment: f.NextComment, Depth: f.Depth}
+	inner.VisitBlockStmt(body.(*Block))
+	f.NextComment = inner.NextComment
+	return inner.sb.String()
+}
+
+func (f *Formatter) VisitUnaryExpr(expr *Unary) any {
+	return expr.Operator.Lexeme + f.expr(expr.Right)
+}
+
+func (f *Formatter) VisitVariableExpr(expr *Variable) any {
+	return expr.Name.Lexeme
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Each source is formatted, then the result formatted again, which must leave it unchanged.
+func TestFormatSourceFixedPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"comments", "// leading\nvar a = 1; // trailing\n{\n// inside a block\nprint a;\n}\n// at the end\n"},
+		{"blank lines", "var a = 1;\n\n\n\nvar b = 2;\n{\n\nprint a;\n\n\nprint b;\n}\n"},
+		{"expression", "1 + 2 * -3;\n"},
+		{"var and const", "var a;\nvar b=1;\nconst c =\"c\";\n"},
+		{"print", "print (1+2)*3 or nil;\n"},
+		{"block", "{ var a = 1; { print a; } }\n"},
+		{"if", "if (true) print 1; else if (false) print 2; else { print 3; }\n"},
+		{"while", "while (false) { print 1; }\n"},
+		{"for", "for (var i = 0; i < 3; i = i + 1) print i;\nfor (;;) { print 1; }\n"},
+		{"for in", "for (var i in 1..<3) print i;\nfor (var i in 0..10 step 2) print i;\n"},
+		{"match", "match (1) {\ncase 1, 2: print \"low\";\n// between cases\ncase 3..10: print \"mid\";\ndefault: print \"high\";\n}\n"},
+		{"select", "var ch = channel();\nselect { case var v = receive(ch): print v; case send(ch, 1): print 1; default: print 0; }\n"},
+		{"throw and try", "try { throw \"oops\"; } catch (e) { print e; } finally { print \"done\"; }\ntry { print 1; } finally { print 2; }\n"},
+		{"generator and yield", "fun* count(limit) {\n// inside a generator\nfor (var i = 0; i < limit; i = i + 1) yield i;\n}\n"},
+		{"import and export", "import \"lib.lox\" as lib;\nexport var a = 1;\nexport const b = 2;\nexport fun* c() { yield 1; }\n"},
+		{"lambda and spawn", "var f = { print 1; };\nf();\nvar t = spawn { print 2; };\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := formatSource(test.source)
+			if err != nil || hadError {
+				t.Fatalf("formatting %q failed: %v", test.source, err)
+			}
+			if got, want := strings.Count(formatted, "//"), strings.Count(test.source, "//"); got != want {
+				t.Errorf("formatted source has %d comments, want %d:\n%s", got, want, formatted)
+			}
+			reformatted, err := formatSource(formatted)
+			if err != nil || hadError {
+				t.Fatalf("formatting the formatted source failed: %v\n%s", err, formatted)
+			}
+			if reformatted != formatted {
+				t.Errorf("formatting is not a fixed point:\n%s\nbecame\n%s", formatted, reformatted)
+			}
+		})
+	}
+}
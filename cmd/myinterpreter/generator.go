@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// The value a generator declaration defines. Calling it binds the arguments and returns a GeneratorObject, without
+// running any of the body yet.
+type LoxGenerator struct {
+	Declaration *Generator
+	Closure     *Environment
+}
+
+func (g *LoxGenerator) Arity() int {
+	return len(g.Declaration.Params)
+}
+
+func (g *LoxGenerator) Call(interpreter *Interpreter, arguments []Value) (Value, error) {
+	environment := NewEnvironment(g.Closure)
+	for index, param := range g.Declaration.Params {
+		environment.define(param.Lexeme, arguments[index])
+	}
+	return ObjectValue(newGeneratorObject(interpreter, g.Declaration, environment)), nil
+}
+
+func (g *LoxGenerator) String() string {
+	return "<fun* " + g.Declaration.Name.Lexeme + ">"
+}
+
+func (g *LoxGenerator) Type() string {
+	return "function"
+}
+
+// Unwinds the body of a generator closed while suspended, so its finally clauses run. It never leaves the generator.
+var errGeneratorClosed = errors.New("generator closed")
+
+// A run of a generator body that is resumed each time the consumer asks for another value.
+// The body runs on its own goroutine, but only while the consumer is blocked waiting for it, so the two never run at
+// the same time and the body can share the consumer's environments and output.
+type GeneratorObject struct {
+	Name string
+	run  *generatorRun
+	// Guards the flags below, since tasks can share a generator.
+	lock    sync.Mutex
+	started bool
+	running bool
+	done    bool
+}
+
+// The part of a generator that its goroutine holds on to. It does not point back at the GeneratorObject, so that
+// an abandoned generator can be garbage collected while its body is suspended.
+type generatorRun struct {
+	interpreter *Interpreter
+	body        []Stmt
+	environment *Environment
+	// Tells the suspended body to carry on (true) or to unwind (false). Closed once the generator is unreachable.
+	resume  chan bool
+	results chan generatorResult
+}
+
+type generatorResult struct {
+	Value Value
+	Done  bool
+	Err   error
+}
+
+func newGeneratorObject(interpreter *Interpreter, declaration *Generator, environment *Environment) *GeneratorObject {
+	run := &generatorRun{
+		body:        declaration.Body.(*Block).Statements,
+		environment: environment,
+		resume:      make(chan bool),
+		results:     make(chan generatorResult),
+	}
+	run.interpreter = &Interpreter{Globals: interpreter.Globals, Runtime: interpreter.Runtime, generator: run}
+	generator := &GeneratorObject{Name: declaration.Name.Lexeme, run: run}
+	// Nobody can resume an unreachable generator, so its goroutine is told to exit without running any more Lox code.
+	runtime.SetFinalizer(generator, func(g *GeneratorObject) { close(g.run.resume) })
+	return generator
+}
+
+func (g *GeneratorObject) String() string {
+	return "<generator " + g.Name + ">"
+}
+
+func (g *GeneratorObject) Type() string {
+	return "generator"
+}
+
+func (g *GeneratorObject) Iterate() Iterator {
+	return g
+}
+
+// Runs the body until it yields or finishes. Errors in the body are returned to the consumer and finish the generator.
+func (g *GeneratorObject) Next() (Value, bool, error) {
+	g.lock.Lock()
+	if g.done {
+		g.lock.Unlock()
+		return Nil, false, nil
+	}
+	if g.running {
+		g.lock.Unlock()
+		return Nil, false, NativeError("Generator '" + g.Name + "' is already running.")
+	}
+	started := g.started
+	g.started = true
+	g.running = true
+	g.lock.Unlock()
+
+	if started {
+		g.run.resume <- true
+	} else {
+		go g.run.start()
+	}
+	result := <-g.run.results
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.running = false
+	if result.Done {
+		g.done = true
+		return Nil, false, result.Err
+	}
+	return result.Value, true, nil
+}
+
+// Finishes a generator early. A body suspended at a yield is unwound, running the finally clauses around it.
+func (g *GeneratorObject) Close() error {
+	g.lock.Lock()
+	if g.done || g.running {
+		g.lock.Unlock()
+		return nil
+	}
+	g.done = true
+	started := g.started
+	g.lock.Unlock()
+	if !started {
+		return nil
+	}
+	g.run.resume <- false
+	for {
+		result := <-g.run.results
+		if result.Done {
+			return result.Err
+		}
+		// A finally clause yielded while unwinding, which only unwinds it further.
+		g.run.resume <- false
+	}
+}
+
+func (r *generatorRun) start() {
+	evalResult := r.interpreter.executeBlock(r.body, r.environment)
+	err := evalResult.Err
+	if errors.Is(err, errGeneratorClosed) {
+		err = nil
+	}
+	r.results <- generatorResult{Done: true, Err: err}
+}
+
+// Hands value to the consumer, then suspends the body until the consumer wants another value or closes the generator.
+func (r *generatorRun) yield(value Value) error {
+	r.results <- generatorResult{Value: value}
+	resume, ok := <-r.resume
+	if !ok {
+		runtime.Goexit()
+	}
+	if !resume {
+		return errGeneratorClosed
+	}
+	return nil
+}
@@ -1,49 +1,219 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type EvalResult struct {
-	Value any
+	Value Value
 	Err   error
 }
 
 // Visitor functions bubble up any runtime errors for the 'Interpret' function to handle.
 type Interpreter struct {
 	Environment *Environment
+	// The outermost environment, where the natives are defined.
+	Globals *Environment
+	*Runtime
+	// Set on the interpreters running generator bodies, to hand yielded values to.
+	generator *generatorRun
+	// The closing paren of the call being made, for natives that need to remember where they were called from.
+	callToken Token
+	// The statement started last, other than a block. Halting points at it, since loops and blocks are only
+	// stepped through on the way to the statements in them.
+	running Stmt
 }
 
-func InterpretStatements(statements []Stmt) {
-	interpreter := &Interpreter{&Environment{Values: make(map[string]any)}}
+// State shared by every interpreter running part of the same program, including the ones running generator bodies.
+type Runtime struct {
+	// Cancelling the context stops the program at the next statement.
+	Context context.Context
+	// Where print writes to. Flushed after every line, so that output is not held back while the program waits or
+	// runs, nor lost if it is killed.
+	Out *bufio.Writer
+	// Each executed statement and each loop iteration is a step. Zero means no limit.
+	MaxSteps int
+	Steps    atomic.Int64
+	// Wall-clock limit for InterpretStatements. Zero means no limit.
+	Timeout time.Duration
+	// Where each statement came from, so that halting can point at the statement it stopped on.
+	// Imported modules add theirs as they are loaded.
+	Spans     map[int]Span
+	spansLock sync.RWMutex
+	// The file being run, which imports in it are resolved relative to.
+	MainFile string
+	// Directories to look for imported files in, after the directory of the importing file.
+	SearchPath []string
+	// The id of the last node parsed so far. Modules are parsed with ids after it, so their spans do not collide.
+	LastId int
+	// The args list of the program, defined as a global of the main file and of every module it imports. Nil unless
+	// the program is run with the run command.
+	Args *List
+	// Cancels Context with the cause given, once InterpretStatements has started.
+	stop context.CancelCauseFunc
+	// Makes timers skip ahead instead of waiting, and clock() count from zero, so that output does not depend on timing.
+	VirtualClock bool
+	// Guards Out, which tasks print to concurrently.
+	outLock sync.Mutex
+	scheduler
+	eventLoop
+	moduleLoader
+}
+
+func NewInterpreter() *Interpreter {
+	globals := NewEnvironment(nil)
+	defineNatives(globals)
+	return &Interpreter{
+		Environment: globals,
+		Globals:     globals,
+		Runtime: &Runtime{
+			Context: context.Background(),
+			Out:     bufio.NewWriter(os.Stdout),
+		},
+	}
+}
+
+func (i *Interpreter) InterpretStatements(statements []Stmt) {
+	if i.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(i.Context, i.Timeout)
+		defer cancel()
+		i.Context = ctx
+	}
+	ctx, stop := context.WithCancelCause(i.Context)
+	defer stop(nil)
+	i.Context, i.stop = ctx, stop
+	defer i.flush()
 	for _, statement := range statements {
-		evalResult := interpreter.execute(statement)
-		var err RuntimeError
-		if errors.As(evalResult.Err, &err) {
-			runtimeError(err)
+		if evalResult := i.execute(statement); evalResult.Err != nil {
+			i.reportError(evalResult.Err)
+			return
+		}
+	}
+	// Timer callbacks can spawn tasks and tasks can set timers, so keep going until neither is left.
+	for {
+		if err := i.runEventLoop(); err != nil {
+			i.reportError(err)
+			return
+		}
+		finished, err := i.waitForTasks()
+		if err != nil {
+			i.reportError(err)
+			return
+		}
+		if finished && !i.hasTimers() {
 			return
 		}
 	}
 }
 
+// Reports an error that ended the program, after whatever was printed before it.
+func (i *Interpreter) reportError(err error) {
+	i.exited(err)
+	i.flush()
+	if exit, ok := asExit(err); ok {
+		exitStatus = exit.Code
+		return
+	}
+	var runtimeErr RuntimeError
+	if errors.As(err, &runtimeErr) {
+		runtimeError(runtimeErr)
+		return
+	}
+	var thrown ThrowError
+	if errors.As(err, &thrown) {
+		uncaughtException(thrown)
+		return
+	}
+	var halt HaltError
+	if errors.As(err, &halt) {
+		haltError(halt)
+	}
+}
+
+func (i *Interpreter) flush() {
+	i.outLock.Lock()
+	defer i.outLock.Unlock()
+	i.Out.Flush()
+}
+
 func InterpretExpr(expression Expr) {
-	interpreter := &Interpreter{&Environment{Values: make(map[string]any)}}
+	interpreter := NewInterpreter()
 	evalResult := interpreter.evaluate(expression)
+	if exit, ok := asExit(evalResult.Err); ok {
+		exitStatus = exit.Code
+		return
+	}
 	var err RuntimeError
 	if errors.As(evalResult.Err, &err) {
 		runtimeError(err)
 		return
 	}
-	fmt.Println(stringify(evalResult.Value, "nil", false))
+	fmt.Println(evalResult.Value)
 }
 
 func (i *Interpreter) evaluate(expr Expr) EvalResult {
-	return expr.Accept(i).(EvalResult)
+	return AcceptExpr[EvalResult](expr, i)
 }
 
 func (i *Interpreter) execute(stmt Stmt) EvalResult {
-	return stmt.Accept(i).(EvalResult)
+	if _, ok := stmt.(*Block); !ok {
+		i.running = stmt
+	}
+	if err := i.step(stmt); err != nil {
+		return EvalResult{Nil, err}
+	}
+	return AcceptStmt[EvalResult](stmt, i)
+}
+
+// Spends one step of the budget on stmt, failing when the budget is exhausted or the context is done.
+func (i *Interpreter) step(stmt Stmt) error {
+	steps := i.Steps.Add(1)
+	if i.MaxSteps > 0 && steps > int64(i.MaxSteps) {
+		return HaltError{i.haltedAt(stmt), ErrStepLimit}
+	}
+	if i.Context.Err() != nil {
+		return HaltError{i.haltedAt(stmt), context.Cause(i.Context)}
+	}
+	return nil
+}
+
+// Returns where the program was when halting on stmt: the statement that was running, rather than the loop going
+// round again or the block being entered. Statements without a span of their own, like the initializer of a for
+// loop, are not pointed at.
+func (i *Interpreter) haltedAt(stmt Stmt) Token {
+	if i.running != nil {
+		if start := i.spanStart(i.running); start.Line > 0 {
+			return start
+		}
+	}
+	return i.spanStart(stmt)
+}
+
+func (r *Runtime) spanStart(stmt Stmt) Token {
+	r.spansLock.RLock()
+	defer r.spansLock.RUnlock()
+	return r.Spans[stmt.NodeId()].Start
+}
+
+func (r *Runtime) addSpans(spans map[int]Span) {
+	r.spansLock.Lock()
+	defer r.spansLock.Unlock()
+	if r.Spans == nil {
+		r.Spans = make(map[int]Span)
+	}
+	for id, span := range spans {
+		r.Spans[id] = span
+	}
 }
 
 func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) EvalResult {
@@ -60,20 +230,108 @@ func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment)
 	return EvalResult{}
 }
 
-func (i *Interpreter) VisitBlockStmt(stmt Block) any {
-	return i.executeBlock(stmt.Statements, &Environment{i.Environment, make(map[string]any)})
+func (i *Interpreter) VisitBlockStmt(stmt *Block) EvalResult {
+	return i.executeBlock(stmt.Statements, NewEnvironment(i.Environment))
+}
+
+// Exported declarations were already collected when the module was loaded, so this only declares.
+func (i *Interpreter) VisitExportStmt(stmt *Export) EvalResult {
+	return i.execute(stmt.Declaration)
 }
 
-func (i *Interpreter) VisitExpressionStmt(stmt Expression) any {
+func (i *Interpreter) VisitExpressionStmt(stmt *Expression) EvalResult {
 	return i.evaluate(stmt.Expression)
 }
 
-func (i *Interpreter) VisitIfStmt(stmt If) any {
+func (i *Interpreter) VisitForStmt(stmt *For) EvalResult {
+	previous := i.Environment
+	defer func() { i.Environment = previous }()
+
+	i.Environment = NewEnvironment(previous)
+	if stmt.Initializer != nil {
+		evalResult := i.execute(stmt.Initializer)
+		if evalResult.Err != nil {
+			return evalResult
+		}
+	}
+	for {
+		if err := i.step(stmt); err != nil {
+			return EvalResult{Nil, err}
+		}
+		if stmt.Condition != nil {
+			evalResult := i.evaluate(stmt.Condition)
+			if evalResult.Err != nil {
+				return evalResult
+			}
+			if !evalResult.Value.Truthy() {
+				return EvalResult{}
+			}
+		}
+		evalResult := i.execute(stmt.Body)
+		if evalResult.Err != nil {
+			return evalResult
+		}
+		if stmt.Increment != nil {
+			evalResult = i.evaluate(stmt.Increment)
+			if evalResult.Err != nil {
+				return evalResult
+			}
+		}
+	}
+}
+
+// Every iteration gets a fresh scope holding its own binding of the loop variable.
+func (i *Interpreter) VisitForInStmt(stmt *ForIn) EvalResult {
+	evalResult := i.evaluate(stmt.Iterable)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	iterator, err := iterate(stmt.In, evalResult.Value)
+	if err != nil {
+		return EvalResult{Nil, err}
+	}
+	for {
+		if err := i.step(stmt); err != nil {
+			return stopIterating(iterator, EvalResult{Nil, err})
+		}
+		value, ok, err := iterator.Next()
+		if err != nil {
+			return EvalResult{Nil, locate(err, stmt.In)}
+		}
+		if !ok {
+			return EvalResult{}
+		}
+		environment := NewEnvironment(i.Environment)
+		environment.define(stmt.Name.Lexeme, value)
+		evalResult := i.executeBlock([]Stmt{stmt.Body}, environment)
+		if evalResult.Err != nil {
+			return stopIterating(iterator, evalResult)
+		}
+	}
+}
+
+// Releases an iterator the loop is leaving before the end, such as a suspended generator.
+// An error from releasing it takes precedence, like an error from a finally clause.
+func stopIterating(iterator Iterator, evalResult EvalResult) EvalResult {
+	if closer, ok := iterator.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return EvalResult{Nil, err}
+		}
+	}
+	return evalResult
+}
+
+func (i *Interpreter) VisitGeneratorStmt(stmt *Generator) EvalResult {
+	i.Environment.define(stmt.Name.Lexeme, ObjectValue(&LoxGenerator{stmt, i.Environment}))
+	return EvalResult{}
+}
+
+func (i *Interpreter) VisitIfStmt(stmt *If) EvalResult {
 	evalResult := i.evaluate(stmt.Condition)
 	if evalResult.Err != nil {
 		return evalResult
 	}
-	if isTruthy(evalResult.Value) {
+	if evalResult.Value.Truthy() {
 		return i.execute(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
 		return i.execute(stmt.ElseBranch)
@@ -81,14 +339,148 @@ func (i *Interpreter) VisitIfStmt(stmt If) any {
 	return EvalResult{}
 }
 
-func (i *Interpreter) VisitPrintStmt(stmt Print) any {
+func (i *Interpreter) VisitImportStmt(stmt *Import) EvalResult {
+	module, err := i.importModule(stmt)
+	if err != nil {
+		return EvalResult{Nil, err}
+	}
+	i.Environment.define(stmt.Name.Lexeme, ObjectValue(module))
+	return EvalResult{}
+}
+
+// The subject is evaluated once, then patterns are tried in order until one matches.
+func (i *Interpreter) VisitMatchStmt(stmt *Match) EvalResult {
+	evalResult := i.evaluate(stmt.Subject)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	subject := evalResult.Value
+
+	for _, matchCase := range stmt.Cases {
+		for _, pattern := range matchCase.Patterns {
+			matched, err := i.matches(subject, pattern)
+			if err != nil {
+				return EvalResult{Nil, err}
+			}
+			if matched {
+				return i.execute(matchCase.Body)
+			}
+		}
+	}
+	if stmt.Default != nil {
+		return i.execute(stmt.Default)
+	}
+	return EvalResult{}
+}
+
+func (i *Interpreter) matches(subject Value, pattern Pattern) (bool, error) {
+	evalResult := i.evaluate(pattern.Value)
+	if evalResult.Err != nil {
+		return false, evalResult.Err
+	}
+	if pattern.End == nil {
+		return subject.Equals(evalResult.Value), nil
+	}
+
+	start := evalResult.Value
+	evalResult = i.evaluate(pattern.End)
+	if evalResult.Err != nil {
+		return false, evalResult.Err
+	}
+	end := evalResult.Value
+	if err := checkNumberOperands(pattern.Operator, start, end, pattern.Value, pattern.End); err != nil {
+		return false, err
+	}
+	number := subject.AsNumber()
+	if !subject.IsNumber() || number < start.AsNumber() {
+		return false, nil
+	}
+	if pattern.Operator.Type == DOT_DOT_LESS {
+		return number < end.AsNumber(), nil
+	}
+	return number <= end.AsNumber(), nil
+}
+
+func (i *Interpreter) VisitPrintStmt(stmt *Print) EvalResult {
 	evalResult := i.evaluate(stmt.Expression)
-	fmt.Println(stringify(evalResult.Value, "", false))
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	i.outLock.Lock()
+	defer i.outLock.Unlock()
+	fmt.Fprintln(i.Out, evalResult.Value)
+	i.Out.Flush()
 	return evalResult
 }
 
-func (i *Interpreter) VisitVarStmt(stmt Var) any {
-	var value any
+// Waits for the first case that can go ahead, or runs the default case when none can right away.
+// Channels and values to send are evaluated once, in order, before waiting.
+func (i *Interpreter) VisitSelectStmt(stmt *Select) EvalResult {
+	cases := []reflect.SelectCase{}
+	for _, selectCase := range stmt.Cases {
+		evalResult := i.evaluate(selectCase.Channel)
+		if evalResult.Err != nil {
+			return evalResult
+		}
+		channel, ok := evalResult.Value.AsObject().(*Channel)
+		if !ok {
+			return EvalResult{Nil, RuntimeError{selectCase.Operation, "Can only " + selectCase.Operation.Lexeme + " on a channel."}}
+		}
+		if selectCase.Value == nil {
+			cases = append(cases, channel.receiveCase())
+			continue
+		}
+		evalResult = i.evaluate(selectCase.Value)
+		if evalResult.Err != nil {
+			return evalResult
+		}
+		cases = append(cases, channel.sendCase(evalResult.Value))
+	}
+
+	chosen, value, _, err := i.block(cases, stmt.Default == nil)
+	if err != nil {
+		return EvalResult{Nil, locate(err, stmt.Keyword)}
+	}
+	if chosen < 0 {
+		return i.execute(stmt.Default)
+	}
+	selectCase := stmt.Cases[chosen]
+	if selectCase.Name.Lexeme == "" {
+		return i.execute(selectCase.Body)
+	}
+	environment := NewEnvironment(i.Environment)
+	environment.define(selectCase.Name.Lexeme, value)
+	return i.executeBlock([]Stmt{selectCase.Body}, environment)
+}
+
+func (i *Interpreter) VisitThrowStmt(stmt *Throw) EvalResult {
+	evalResult := i.evaluate(stmt.Value)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	return EvalResult{Nil, ThrowError{stmt.Keyword, evalResult.Value}}
+}
+
+// The finally clause runs however the try statement is left, and its own error takes precedence.
+func (i *Interpreter) VisitTryStmt(stmt *Try) EvalResult {
+	evalResult := i.execute(stmt.Body)
+	if evalResult.Err != nil && stmt.CatchBody != nil {
+		if value, ok := caughtValue(evalResult.Err); ok {
+			environment := NewEnvironment(i.Environment)
+			environment.define(stmt.CatchName.Lexeme, value)
+			evalResult = i.executeBlock([]Stmt{stmt.CatchBody}, environment)
+		}
+	}
+	if stmt.FinallyBody != nil {
+		if finallyResult := i.execute(stmt.FinallyBody); finallyResult.Err != nil {
+			return finallyResult
+		}
+	}
+	return evalResult
+}
+
+func (i *Interpreter) VisitVarStmt(stmt *Var) EvalResult {
+	value := Nil
 	if stmt.Initializer != nil {
 		evalResult := i.evaluate(stmt.Initializer)
 		if evalResult.Err != nil {
@@ -96,18 +488,33 @@ func (i *Interpreter) VisitVarStmt(stmt Var) any {
 		}
 		value = evalResult.Value
 	}
+	if stmt.Keyword.Type == CONST {
+		i.Environment.defineConstant(stmt.Name.Lexeme, value)
+		return EvalResult{}
+	}
 	i.Environment.define(stmt.Name.Lexeme, value)
 	return EvalResult{}
 }
 
+func (i *Interpreter) VisitYieldStmt(stmt *Yield) EvalResult {
+	evalResult := i.evaluate(stmt.Value)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	return EvalResult{Nil, i.generator.yield(evalResult.Value)}
+}
+
 // Hmm...
-func (i *Interpreter) VisitWhileStmt(stmt While) any {
+func (i *Interpreter) VisitWhileStmt(stmt *While) EvalResult {
 	evalResult := i.evaluate(stmt.Condition)
 	if evalResult.Err != nil {
 		return evalResult
 	}
 	whileCondition := evalResult.Value
-	for isTruthy(whileCondition) {
+	for whileCondition.Truthy() {
+		if err := i.step(stmt); err != nil {
+			return EvalResult{Nil, err}
+		}
 		evalResult := i.execute(stmt.Body)
 		if evalResult.Err != nil {
 			return evalResult
@@ -121,16 +528,18 @@ func (i *Interpreter) VisitWhileStmt(stmt While) any {
 	return EvalResult{}
 }
 
-func (i *Interpreter) VisitAssignExpr(expr Assign) any {
+func (i *Interpreter) VisitAssignExpr(expr *Assign) EvalResult {
 	evalResult := i.evaluate(expr.Value)
 	if evalResult.Err != nil {
 		return evalResult
 	}
-	i.Environment.assign(expr.Name, evalResult.Value)
+	if err := i.Environment.assign(expr.Binding, expr.Name, evalResult.Value); err != nil {
+		return EvalResult{Nil, err}
+	}
 	return EvalResult{evalResult.Value, nil}
 }
 
-func (i *Interpreter) VisitBinaryExpr(expr Binary) any {
+func (i *Interpreter) VisitBinaryExpr(expr *Binary) EvalResult {
 	leftResult := i.evaluate(expr.Left)
 	if leftResult.Err != nil {
 		return leftResult
@@ -145,82 +554,142 @@ func (i *Interpreter) VisitBinaryExpr(expr Binary) any {
 
 	switch expr.Operator.Type {
 	case BANG_EQUAL:
-		return EvalResult{!isEqual(left, right), nil}
+		return EvalResult{BoolValue(!left.Equals(right)), nil}
 	case EQUAL_EQUAL:
-		return EvalResult{isEqual(left, right), nil}
+		return EvalResult{BoolValue(left.Equals(right)), nil}
 	case GREATER:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) > right.(float64), nil}
+		return EvalResult{BoolValue(left.AsNumber() > right.AsNumber()), nil}
 	case GREATER_EQUAL:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) >= right.(float64), nil}
+		return EvalResult{BoolValue(left.AsNumber() >= right.AsNumber()), nil}
 	case LESS:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) < right.(float64), nil}
+		return EvalResult{BoolValue(left.AsNumber() < right.AsNumber()), nil}
 	case LESS_EQUAL:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) <= right.(float64), nil}
+		return EvalResult{BoolValue(left.AsNumber() <= right.AsNumber()), nil}
 	case MINUS:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) - right.(float64), nil}
+		return EvalResult{NumberValue(left.AsNumber() - right.AsNumber()), nil}
 	case SLASH:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) / right.(float64), nil}
+		return EvalResult{NumberValue(left.AsNumber() / right.AsNumber()), nil}
 	case STAR:
-		err := checkNumberOperands(expr.Operator, left, right)
+		err := checkNumberOperands(expr.Operator, left, right, expr.Left, expr.Right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{left.(float64) * right.(float64), nil}
+		return EvalResult{NumberValue(left.AsNumber() * right.AsNumber()), nil}
 	case PLUS:
-		numberLeft, leftIsNumber := left.(float64)
-		numberRight, rightIsNumber := right.(float64)
-
-		if leftIsNumber && rightIsNumber {
-			return EvalResult{numberLeft + numberRight, nil}
+		if left.IsNumber() && right.IsNumber() {
+			return EvalResult{NumberValue(left.AsNumber() + right.AsNumber()), nil}
 		}
-
-		stringLeft, leftIsString := left.(string)
-		stringRight, rightIsString := right.(string)
-
-		if leftIsString && rightIsString {
-			return EvalResult{stringLeft + stringRight, nil}
+		if left.IsString() && right.IsString() {
+			return EvalResult{StringValue(left.AsString() + right.AsString()), nil}
 		}
 
-		return EvalResult{nil, RuntimeError{expr.Operator, "Operands must be two numbers or two strings."}}
+		leftWrong := !left.IsNumber() && !left.IsString()
+		rightWrong := !right.IsNumber() && !right.IsString()
+		token := wrongOperand(expr.Operator, leftWrong, rightWrong, expr.Left, expr.Right)
+		return EvalResult{Nil, operandsError(token, expr.Operator, "must be two numbers or two strings", left, right)}
 	}
 
 	// Unreachable.
 	return EvalResult{}
 }
 
-func (i *Interpreter) VisitGroupingExpr(expr Grouping) any {
+func (i *Interpreter) VisitCallExpr(expr *Call) EvalResult {
+	evalResult := i.evaluate(expr.Callee)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	callee := evalResult.Value
+
+	arguments := []Value{}
+	for _, argument := range expr.Arguments {
+		evalResult := i.evaluate(argument)
+		if evalResult.Err != nil {
+			return evalResult
+		}
+		arguments = append(arguments, evalResult.Value)
+	}
+
+	function, ok := callee.AsObject().(Callable)
+	if !ok {
+		return EvalResult{Nil, RuntimeError{expr.Paren, "Can only call functions and generators."}}
+	}
+	if len(arguments) != function.Arity() {
+		return EvalResult{Nil, RuntimeError{expr.Paren, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments))}}
+	}
+	i.callToken = expr.Paren
+	value, err := function.Call(i, arguments)
+	return EvalResult{value, locate(err, expr.Paren)}
+}
+
+func (i *Interpreter) VisitConditionalExpr(expr *Conditional) EvalResult {
+	evalResult := i.evaluate(expr.Condition)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	if evalResult.Value.Truthy() {
+		return i.evaluate(expr.ThenBranch)
+	}
+	return i.evaluate(expr.ElseBranch)
+}
+
+func (i *Interpreter) VisitGetExpr(expr *Get) EvalResult {
+	evalResult := i.evaluate(expr.Object)
+	if evalResult.Err != nil {
+		return evalResult
+	}
+	if module, ok := evalResult.Value.AsObject().(*Module); ok {
+		value, err := module.get(expr.Name)
+		return EvalResult{value, err}
+	}
+	if loxError, ok := evalResult.Value.AsObject().(*LoxError); ok {
+		switch expr.Name.Lexeme {
+		case "message":
+			return EvalResult{StringValue(loxError.Message), nil}
+		case "line":
+			return EvalResult{NumberValue(float64(loxError.Line)), nil}
+		}
+		return EvalResult{Nil, RuntimeError{expr.Name, "Undefined property '" + expr.Name.Lexeme + "'."}}
+	}
+	return EvalResult{Nil, RuntimeError{expr.Name, "Only errors and modules have properties."}}
+}
+
+func (i *Interpreter) VisitGroupingExpr(expr *Grouping) EvalResult {
 	return i.evaluate(expr.Expression)
 }
 
-func (i *Interpreter) VisitLiteralExpr(expr Literal) any {
-	return EvalResult{expr.Value, nil}
+func (i *Interpreter) VisitLambdaExpr(expr *Lambda) EvalResult {
+	return EvalResult{ObjectValue(&LoxLambda{expr, i.Environment}), nil}
 }
 
-func (i *Interpreter) VisitLogicalExpr(expr Logical) any {
+func (i *Interpreter) VisitLiteralExpr(expr *Literal) EvalResult {
+	return EvalResult{valueOf(expr.Value), nil}
+}
+
+func (i *Interpreter) VisitLogicalExpr(expr *Logical) EvalResult {
 	evalResult := i.evaluate(expr.Left)
 	if evalResult.Err != nil {
 		return evalResult
@@ -228,11 +697,15 @@ func (i *Interpreter) VisitLogicalExpr(expr Logical) any {
 	left := evalResult.Value
 
 	if expr.Operator.Type == OR {
-		if isTruthy(left) {
+		if left.Truthy() {
+			return EvalResult{left, nil}
+		}
+	} else if expr.Operator.Type == QUESTION_QUESTION {
+		if !left.IsNil() {
 			return EvalResult{left, nil}
 		}
 	} else {
-		if !isTruthy(left) {
+		if !left.Truthy() {
 			return EvalResult{left, nil}
 		}
 	}
@@ -240,7 +713,48 @@ func (i *Interpreter) VisitLogicalExpr(expr Logical) any {
 	return i.evaluate(expr.Right)
 }
 
-func (i *Interpreter) VisitUnaryExpr(expr Unary) any {
+func (i *Interpreter) VisitRangeExpr(expr *Range) EvalResult {
+	startResult := i.evaluate(expr.Start)
+	if startResult.Err != nil {
+		return startResult
+	}
+	endResult := i.evaluate(expr.End)
+	if endResult.Err != nil {
+		return endResult
+	}
+	if err := checkNumberOperands(expr.Operator, startResult.Value, endResult.Value, expr.Start, expr.End); err != nil {
+		return EvalResult{Nil, err}
+	}
+	start := startResult.Value.AsNumber()
+	end := endResult.Value.AsNumber()
+
+	// Without an explicit step, ranges count towards their end.
+	step := 1.0
+	if end < start {
+		step = -1
+	}
+	if expr.Step != nil {
+		stepResult := i.evaluate(expr.Step)
+		if stepResult.Err != nil {
+			return stepResult
+		}
+		if err := checkNumberOperand(expr.Operator, stepResult.Value); err != nil {
+			return EvalResult{Nil, err}
+		}
+		step = stepResult.Value.AsNumber()
+		if step == 0 {
+			return EvalResult{Nil, RuntimeError{expr.Operator, "Range step must not be zero."}}
+		}
+	}
+
+	return EvalResult{ObjectValue(NumberRange{start, end, step, expr.Operator.Type == DOT_DOT}), nil}
+}
+
+func (i *Interpreter) VisitSpawnExpr(expr *Spawn) EvalResult {
+	return EvalResult{ObjectValue(i.spawn(expr.Keyword, expr.Body.(*Block))), nil}
+}
+
+func (i *Interpreter) VisitUnaryExpr(expr *Unary) EvalResult {
 	rightResult := i.evaluate(expr.Right)
 	if rightResult.Err != nil {
 		return rightResult
@@ -252,61 +766,109 @@ func (i *Interpreter) VisitUnaryExpr(expr Unary) any {
 	case MINUS:
 		err := checkNumberOperand(expr.Operator, right)
 		if err != nil {
-			return EvalResult{nil, err}
+			return EvalResult{Nil, err}
 		}
-		return EvalResult{-right.(float64), nil}
+		return EvalResult{NumberValue(-right.AsNumber()), nil}
 	case BANG:
-		return EvalResult{!isTruthy(right), nil}
+		return EvalResult{BoolValue(!right.Truthy()), nil}
 	}
 
 	// Unreachable.
 	return EvalResult{}
 }
 
-func (i *Interpreter) VisitVariableExpr(expr Variable) any {
-	value, err := i.Environment.get(expr.Name)
+func (i *Interpreter) VisitVariableExpr(expr *Variable) EvalResult {
+	value, err := i.Environment.get(expr.Binding, expr.Name)
 	return EvalResult{value, err}
 }
 
-func checkNumberOperand(operator Token, operand any) error {
-	if _, ok := operand.(float64); ok {
+func checkNumberOperand(operator Token, operand Value) error {
+	if operand.IsNumber() {
 		return nil
 	}
-	return RuntimeError{operator, "Operand must be a number."}
+	return RuntimeError{operator, fmt.Sprintf("Operand of '%s' must be a number, got %s.", operator.Lexeme, describe(operand))}
 }
 
-func checkNumberOperands(operator Token, left, right any) error {
-	_, leftOk := left.(float64)
-	_, rightOk := right.(float64)
-
-	if leftOk && rightOk {
+// When only one of the operands is not a number, the error points at it.
+func checkNumberOperands(operator Token, left, right Value, leftExpr, rightExpr Expr) error {
+	if left.IsNumber() && right.IsNumber() {
 		return nil
 	}
 
-	return RuntimeError{operator, "Operands must be numbers."}
+	token := wrongOperand(operator, !left.IsNumber(), !right.IsNumber(), leftExpr, rightExpr)
+	return operandsError(token, operator, "must be numbers", left, right)
 }
 
-func isTruthy(object any) bool {
-	if object == nil {
-		return false
+// Reports at token that the operands of operator are not what requirement says they must be.
+func operandsError(token, operator Token, requirement string, left, right Value) error {
+	message := fmt.Sprintf("Operands of '%s' %s, got %s and %s.", operator.Lexeme, requirement, describe(left), describe(right))
+	return RuntimeError{token, message}
+}
+
+// Returns the token an error about the types of the operands of operator points at: the start of the operand that is
+// wrong if only one is, otherwise the operator.
+func wrongOperand(operator Token, leftWrong, rightWrong bool, leftExpr, rightExpr Expr) Token {
+	if leftWrong == rightWrong {
+		return operator
+	}
+	wrong := leftExpr
+	if rightWrong {
+		wrong = rightExpr
 	}
-	if boolObject, ok := object.(bool); ok {
-		return boolObject
+	if token := exprToken(wrong); token.Line > 0 {
+		return token
 	}
-	return true
+	return operator
 }
 
-/*
-Not sure about this one.
-I cargoculted the java logic but golang nil has different semantics than Java null.
-And they use a.equals(b) instead of a == b.
-*/
-func isEqual(a, b any) bool {
-	if a == nil && b == nil {
-		return true
+// Returns the first token of expr, or the zero Token if it has none, like a lambda.
+func exprToken(expr Expr) Token {
+	switch expr := expr.(type) {
+	case *Assign:
+		return expr.Name
+	case *Binary:
+		return exprToken(expr.Left)
+	case *Call:
+		return exprToken(expr.Callee)
+	case *Conditional:
+		return exprToken(expr.Condition)
+	case *Get:
+		return exprToken(expr.Object)
+	case *Grouping:
+		return exprToken(expr.Expression)
+	case *Literal:
+		return expr.Token
+	case *Logical:
+		return exprToken(expr.Left)
+	case *Range:
+		return exprToken(expr.Start)
+	case *Spawn:
+		return expr.Keyword
+	case *Unary:
+		return expr.Operator
+	case *Variable:
+		return expr.Name
 	}
-	if a == nil {
-		return false
+	return Token{}
+}
+
+// Describes a value in an error message by its type and how it prints, cut short if it is long.
+func describe(value Value) string {
+	const limit = 24
+	if value.Type() == "nil" {
+		return "nil"
+	}
+	text := value.String()
+	if runes := []rune(text); len(runes) > limit {
+		text = string(runes[:limit]) + "..."
 	}
-	return a == b
+	if value.IsString() {
+		text = strconv.Quote(text)
+	}
+	return value.Type() + " " + text
+}
+
+// Literals are truthy when the value they evaluate to is.
+func isTruthy(literal any) bool {
+	return valueOf(literal).Truthy()
 }
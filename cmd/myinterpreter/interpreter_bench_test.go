@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"testing"
+)
+
+// Runs the scripts in the bench directory through InterpretStatements, the way the bench command does. Parsing is not
+// timed. Compare two commits with:
+//
+//	go test -run '^$' -bench . -count 10 ./cmd/myinterpreter
+func benchmarkScript(b *testing.B, filename string) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, parser, statements := parseProgram(string(source))
+	if hadError {
+		b.Fatalf("%s does not parse", filename)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for run := 0; run < b.N; run++ {
+		interpreter := NewInterpreter()
+		interpreter.Out = bufio.NewWriter(io.Discard)
+		interpreter.Spans = parser.Spans
+		interpreter.LastId = parser.LastId
+		interpreter.InterpretStatements(statements)
+		if hadRuntimeError || hadHaltError {
+			b.Fatalf("%s failed", filename)
+		}
+	}
+}
+
+func BenchmarkArithmetic(b *testing.B) {
+	benchmarkScript(b, "../../bench/arithmetic.lox")
+}
+
+func BenchmarkLoops(b *testing.B) {
+	benchmarkScript(b, "../../bench/loops.lox")
+}
+
+func BenchmarkNestedBlocks(b *testing.B) {
+	benchmarkScript(b, "../../bench/nested_blocks.lox")
+}
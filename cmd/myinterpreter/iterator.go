@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Produces the values a for-in loop visits, one at a time.
+type Iterator interface {
+	// Returns false once there are no more values.
+	Next() (Value, bool, error)
+}
+
+// Implemented by every runtime value a for-in loop can visit, apart from strings.
+type Iterable interface {
+	Iterate() Iterator
+}
+
+// The runtime value of a range expression.
+// Values of ranges are computed as Start + n * Step rather than accumulated, so fractional steps do not drift.
+type NumberRange struct {
+	Start     float64
+	End       float64
+	Step      float64
+	Inclusive bool
+}
+
+func (r NumberRange) String() string {
+	operator := "..<"
+	if r.Inclusive {
+		operator = ".."
+	}
+	text := stringifyNumber(r.Start, false) + operator + stringifyNumber(r.End, false)
+	if r.Step != 1 && r.Step != -1 {
+		text += " step " + stringifyNumber(r.Step, false)
+	}
+	return text
+}
+
+func (r NumberRange) Type() string {
+	return "range"
+}
+
+func (r NumberRange) Iterate() Iterator {
+	return &rangeIterator{r, 0}
+}
+
+type rangeIterator struct {
+	Range NumberRange
+	Index int
+}
+
+func (it *rangeIterator) Next() (Value, bool, error) {
+	r := it.Range
+	value := r.Start + float64(it.Index)*r.Step
+	var more bool
+	switch {
+	case r.Step > 0 && r.Inclusive:
+		more = value <= r.End
+	case r.Step > 0:
+		more = value < r.End
+	case r.Inclusive:
+		more = value >= r.End
+	default:
+		more = value > r.End
+	}
+	if !more {
+		return Nil, false, nil
+	}
+	it.Index++
+	return NumberValue(value), true, nil
+}
+
+// A fixed sequence of values, like the args the program was run with.
+type List struct {
+	Elements []Value
+}
+
+func (l *List) String() string {
+	elements := make([]string, len(l.Elements))
+	for index, element := range l.Elements {
+		elements[index] = element.String()
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (l *List) Type() string {
+	return "list"
+}
+
+func (l *List) Iterate() Iterator {
+	return &listIterator{l, 0}
+}
+
+type listIterator struct {
+	List  *List
+	Index int
+}
+
+func (it *listIterator) Next() (Value, bool, error) {
+	if it.Index >= len(it.List.Elements) {
+		return Nil, false, nil
+	}
+	it.Index++
+	return it.List.Elements[it.Index-1], true, nil
+}
+
+// Strings are iterated one character at a time.
+type stringIterator struct {
+	String string
+}
+
+func (it *stringIterator) Next() (Value, bool, error) {
+	if it.String == "" {
+		return Nil, false, nil
+	}
+	_, size := utf8.DecodeRuneInString(it.String)
+	character := it.String[:size]
+	it.String = it.String[size:]
+	return StringValue(character), true, nil
+}
+
+func iterate(token Token, value Value) (Iterator, error) {
+	if value.IsString() {
+		return &stringIterator{value.AsString()}, nil
+	}
+	if iterable, ok := value.AsObject().(Iterable); ok {
+		return iterable.Iterate(), nil
+	}
+	return nil, RuntimeError{token, fmt.Sprintf("Value %s is not iterable.", value)}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ruleUnusedVariable    = "unused-variable"
+	ruleShadowing         = "shadowing"
+	ruleSelfAssignment    = "self-assignment"
+	ruleConstantCondition = "constant-condition"
+	ruleEmptyBlock        = "empty-block"
+	ruleUnreachableCode   = "unreachable-code"
+	// Reported by the parser.
+	ruleDuplicateCase = "duplicate-case"
+)
+
+// Rules can be switched off for a whole file with a comment like "// lint:disable shadowing, empty-block".
+const lintDirective = "// lint:disable"
+
+type Warning struct {
+	Rule    string
+	Token   Token
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s Warning (%s): %s", location(w.Token.File, w.Token.Line), w.Rule, w.Message)
+}
+
+type declaration struct {
+	Name Token
+	Read bool
+}
+
+// Walks the parsed program looking for code that is legal but probably not what was meant.
+type Linter struct {
+	Spans    map[int]Span
+	Disabled map[string]bool
+	// The innermost scope is last; the first one holds the globals.
+	Scopes   []map[string]*declaration
+	Warnings []Warning
+}
+
+// Lints statements, including the warnings the parser already found in them.
+func Lint(statements []Stmt, parser *Parser, comments []Comment) []Warning {
+	l := &Linter{Spans: parser.Spans, Disabled: disabledRules(comments)}
+	for _, warning := range parser.Warnings {
+		l.warn(warning.Rule, warning.Token, warning.Message)
+	}
+	l.beginScope()
+	l.statements(statements)
+
+	sort.Slice(l.Warnings, func(a, b int) bool {
+		if l.Warnings[a].Token.Line != l.Warnings[b].Token.Line {
+			return l.Warnings[a].Token.Line < l.Warnings[b].Token.Line
+		}
+		return l.Warnings[a].String() < l.Warnings[b].String()
+	})
+	return l.Warnings
+}
+
+func disabledRules(comments []Comment) map[string]bool {
+	disabled := make(map[string]bool)
+	for _, comment := range comments {
+		rules, ok := strings.CutPrefix(comment.Text, lintDirective)
+		if !ok {
+			continue
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			disabled[strings.TrimSpace(rule)] = true
+		}
+	}
+	return disabled
+}
+
+func (l *Linter) warn(rule string, token Token, message string) {
+	if l.Disabled[rule] {
+		return
+	}
+	l.Warnings = append(l.Warnings, Warning{rule, token, message})
+}
+
+func (l *Linter) beginScope() {
+	l.Scopes = append(l.Scopes, make(map[string]*declaration))
+}
+
+// Locals that were never read are reported when their scope ends; globals may be read by code we cannot see.
+func (l *Linter) endScope() {
+	scope := l.Scopes[len(l.Scopes)-1]
+	l.Scopes = l.Scopes[:len(l.Scopes)-1]
+	for _, declaration := range scope {
+		if !declaration.Read {
+			l.warn(ruleUnusedVariable, declaration.Name, "Local variable '"+declaration.Name.Lexeme+"' is declared but never read.")
+		}
+	}
+}
+
+func (l *Linter) declare(name Token) {
+	for depth := len(l.Scopes) - 2; depth >= 0; depth-- {
+		if outer, ok := l.Scopes[depth][name.Lexeme]; ok {
+			l.warn(ruleShadowing, name, fmt.Sprintf("'%s' shadows the declaration on line %d.", name.Lexeme, outer.Name.Line))
+			break
+		}
+	}
+	l.Scopes[len(l.Scopes)-1][name.Lexeme] = &declaration{Name: name, Read: len(l.Scopes) == 1}
+}
+
+func (l *Linter) read(name Token) {
+	for depth := len(l.Scopes) - 1; depth >= 0; depth-- {
+		if declaration, ok := l.Scopes[depth][name.Lexeme]; ok {
+			declaration.Read = true
+			return
+		}
+	}
+}
+
+func (l *Linter) statements(statements []Stmt) {
+	reachable := true
+	for _, statement := range statements {
+		if !reachable {
+			l.warn(ruleUnreachableCode, l.Spans[statement.NodeId()].Start, "Unreachable code.")
+			// Only the first unreachable statement is reported, the rest are implied.
+			reachable = true
+		}
+		l.stmt(statement)
+		if neverCompletes(statement) {
+			reachable = false
+		}
+	}
+}
+
+func (l *Linter) stmt(stmt Stmt) {
+	stmt.Accept(l)
+}
+
+func (l *Linter) expr(expr Expr) {
+	expr.Accept(l)
+}
+
+// Conditions are constant when the optimizer can fold them to a literal.
+// A bare 'true' is left alone since it is the idiomatic way to write a loop that never ends on its own.
+func (l *Linter) condition(stmt Stmt, condition Expr, allowTrue bool) {
+	l.expr(condition)
+	literal, ok := (&Optimizer{}).expr(condition).(*Literal)
+	if !ok {
+		return
+	}
+	if original, ok := condition.(*Literal); ok && allowTrue && original.Value == true {
+		return
+	}
+	l.warn(ruleConstantCondition, l.Spans[stmt.NodeId()].Start, "Condition is always "+stringify(isTruthy(literal.Value), "", false)+".")
+}
+
+func (l *Linter) VisitBlockStmt(stmt *Block) any {
+	if len(stmt.Statements) == 0 {
+		l.warn(ruleEmptyBlock, l.Spans[stmt.NodeId()].Start, "Empty block.")
+	}
+	l.beginScope()
+	l.statements(stmt.Statements)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitExportStmt(stmt *Export) any {
+	l.stmt(stmt.Declaration)
+	return nil
+}
+
+func (l *Linter) VisitExpressionStmt(stmt *Expression) any {
+	l.expr(stmt.Expression)
+	return nil
+}
+
+func (l *Linter) VisitForStmt(stmt *For) any {
+	l.beginScope()
+	if stmt.Initializer != nil {
+		l.stmt(stmt.Initializer)
+	}
+	if stmt.Condition != nil {
+		l.condition(stmt, stmt.Condition, true)
+	}
+	if stmt.Increment != nil {
+		l.expr(stmt.Increment)
+	}
+	l.stmt(stmt.Body)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitForInStmt(stmt *ForIn) any {
+	l.expr(stmt.Iterable)
+	l.beginScope()
+	l.declare(stmt.Name)
+	l.stmt(stmt.Body)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitGeneratorStmt(stmt *Generator) any {
+	l.declare(stmt.Name)
+	l.beginScope()
+	// Parameters are part of the generator's signature, so leaving one unused is not a mistake.
+	for _, param := range stmt.Params {
+		l.declare(param)
+		l.read(param)
+	}
+	l.stmt(stmt.Body)
+	l.endScope()
+	return nil
+}
+
+func (l *Linter) VisitIfStmt(stmt *If) any {
+	l.condition(stmt, stmt.Condition, false)
+	l.stmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		l.stmt(stmt.ElseBranch)
+	}
+	return nil
+}
+
+func (l *Linter) VisitImportStmt(stmt *Import) any {
+	l.declare(stmt.Name)
+	return nil
+}
+
+func (l *Linter) VisitMatchStmt(stmt *Match) any {
+	l.expr(stmt.Subject)
+	for _, matchCase := range stmt.Cases {
+		for _, pattern := range matchCase.Patterns {
+			l.expr(pattern.Value)
+			if pattern.End != nil {
+				l.expr(pattern.End)
+			}
+		}
+		l.caseBody(matchCase.Body)
+	}
+	if stmt.Default != nil {
+		l.caseBody(stmt.Default)
+	}
+	return nil
+}
+
+// Case bodies are blocks without braces, and an empty one is a deliberate way to ignore some values.
+func (l *Linter) caseBody(body Stmt) {
+	l.beginScope()
+	l.statements(body.(*Block).Statements)
+	l.endScope()
+}
+
+func (l *Linter) VisitPrintStmt(stmt *Print) any {
+	l.expr(stmt.Expression)
+	return nil
+}
+
+func (l *Linter) VisitSelectStmt(stmt *Select) any {
+	for _, selectCase := range stmt.Cases {
+		l.expr(selectCase.Channel)
+		if selectCase.Value != nil {
+			l.expr(selectCase.Value)
+		}
+		l.beginScope()
+		if selectCase.Name.Lexeme != "" {
+			l.declare(selectCase.Name)
+		}
+		l.statements(selectCase.Body.(*Block).Statements)
+		l.endScope()
+	}
+	if stmt.Default != nil {
+		l.caseBody(stmt.Default)
+	}
+	return nil
+}
+
+func (l *Linter) VisitThrowStmt(stmt *Throw) any {
+	l.expr(stmt.Value)
+	return nil
+}
+
+func (l *Linter) VisitTryStmt(stmt *Try) any {
+	l.stmt(stmt.Body)
+	if stmt.CatchBody != nil {
+		l.beginScope()
+		// Catching without looking at the value is normal, so the name never counts as unused.
+		l.declare(stmt.CatchName)
+		l.read(stmt.CatchName)
+		l.stmt(stmt.CatchBody)
+		l.endScope()
+	}
+	if stmt.FinallyBody != nil {
+		l.stmt(stmt.FinallyBody)
+	}
+	return nil
+}
+
+func (l *Linter) VisitVarStmt(stmt *Var) any {
+	if stmt.Initializer != nil {
+		l.expr(stmt.Initializer)
+	}
+	l.declare(stmt.Name)
+	return nil
+}
+
+func (l *Linter) VisitWhileStmt(stmt *While) any {
+	l.condition(stmt, stmt.Condition, true)
+	l.stmt(stmt.Body)
+	return nil
+}
+
+func (l *Linter) VisitYieldStmt(stmt *Yield) any {
+	l.expr(stmt.Value)
+	return nil
+}
+
+func (l *Linter) VisitAssignExpr(expr *Assign) any {
+	if variable, ok := ungroup(expr.Value).(*Variable); ok && variable.Name.Lexeme == expr.Name.Lexeme {
+		l.warn(ruleSelfAssignment, expr.Name, "'"+expr.Name.Lexeme+"' is assigned to itself.")
+		return nil
+	}
+	l.expr(expr.Value)
+	return nil
+}
+
+func (l *Linter) VisitBinaryExpr(expr *Binary) any {
+	l.expr(expr.Left)
+	l.expr(expr.Right)
+	return nil
+}
+
+func (l *Linter) VisitCallExpr(expr *Call) any {
+	l.expr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		l.expr(argument)
+	}
+	return nil
+}
+
+func (l *Linter) VisitConditionalExpr(expr *Conditional) any {
+	l.expr(expr.Condition)
+	if _, ok := (&Optimizer{}).expr(expr.Condition).(*Literal); ok {
+		l.warn(ruleConstantCondition, expr.Operator, "Condition is constant.")
+	}
+	l.expr(expr.ThenBranch)
+	l.expr(expr.ElseBranch)
+	return nil
+}
+
+func (l *Linter) VisitGetExpr(expr *Get) any {
+	l.expr(expr.Object)
+	return nil
+}
+
+func (l *Linter) VisitGroupingExpr(expr *Grouping) any {
+	l.expr(expr.Expression)
+	return nil
+}
+
+func (l *Linter) VisitLambdaExpr(expr *Lambda) any {
+	l.stmt(expr.Body)
+	return nil
+}
+
+func (l *Linter) VisitLiteralExpr(expr *Literal) any {
+	return nil
+}
+
+func (l *Linter) VisitLogicalExpr(expr *Logical) any {
+	l.expr(expr.Left)
+	if _, ok := (&Optimizer{}).expr(expr.Left).(*Literal); ok {
+		l.warn(ruleConstantCondition, expr.Operator, "Left operand of '"+expr.Operator.Lexeme+"' is constant.")
+	}
+	l.expr(expr.Right)
+	return nil
+}
+
+func (l *Linter) VisitRangeExpr(expr *Range) any {
+	l.expr(expr.Start)
+	l.expr(expr.End)
+	if expr.Step != nil {
+		l.expr(expr.Step)
+	}
+	return nil
+}
+
+func (l *Linter) VisitSpawnExpr(expr *Spawn) any {
+	l.stmt(expr.Body)
+	return nil
+}
+
+func (l *Linter) VisitUnaryExpr(expr *Unary) any {
+	l.expr(expr.Right)
+	return nil
+}
+
+func (l *Linter) VisitVariableExpr(expr *Variable) any {
+	l.read(expr.Name)
+	return nil
+}
+
+// Reports statements that never pass control on to the next one: throws, and loops whose condition is always true,
+// since without break there is no way out of those.
+func neverCompletes(stmt Stmt) bool {
+	var condition Expr
+	switch s := stmt.(type) {
+	case *Throw:
+		return true
+	case *While:
+		condition = s.Condition
+	case *For:
+		if s.Condition == nil {
+			return true
+		}
+		condition = s.Condition
+	default:
+		return false
+	}
+	literal, ok := (&Optimizer{}).expr(condition).(*Literal)
+	return ok && isTruthy(literal.Value)
+}
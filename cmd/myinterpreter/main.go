@@ -1,112 +1,375 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 )
 
 var hadError = false
 var hadRuntimeError = false
+var hadHaltError = false
+var wasInterrupted = false
 
-func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh tokenize <filename>")
-		os.Exit(1)
-	}
+// The status the program asked to exit with by calling exit(), or -1.
+var exitStatus = -1
 
-	command := os.Args[1]
+// How diagnostics name the main program when it is not read from a file, which goes unnamed.
+var mainName = ""
 
-	switch command {
-	case "tokenize":
-		tokens := runTokenize(os.Args[2])
-		print(tokens)
-		if hadError {
-			os.Exit(65)
-		}
-	case "parse":
-		tokens := runTokenize(os.Args[2])
-		expr := runParseToExpr(tokens)
-		if hadError {
-			os.Exit(65)
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	switch name := os.Args[1]; name {
+	case "-h", "-help", "--help", "help":
+		if len(os.Args) > 2 && findCommand(os.Args[2]) != nil {
+			c := findCommand(os.Args[2])
+			c.Run(c, []string{"--help"})
+			return
 		}
-		fmt.Println(PrintAst(expr))
-	case "evaluate":
-		tokens := runTokenize(os.Args[2])
-		expr := runParseToExpr(tokens)
-		InterpretExpr(expr)
-		if hadRuntimeError {
-			os.Exit(70)
+		usage(os.Stdout)
+	case "-version", "--version", "version":
+		fmt.Println(versionString())
+	default:
+		c := findCommand(name)
+		if c == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+			fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", programName)
+			os.Exit(exitUsage)
 		}
-	case "run":
-		tokens := runTokenize(os.Args[2])
-		statements := runParseToStatements(tokens)
-		if hadError {
-			os.Exit(65)
+		c.Run(c, os.Args[2:])
+	}
+}
+
+func tokenizeCommand(c *command, args []string) {
+	source, _, _ := c.openProgram(c.programFlags(args))
+	defer source.Close()
+	runTokenize(source)
+	if hadError {
+		os.Exit(exitCompile)
+	}
+}
+
+func parseCommand(c *command, args []string) {
+	source, _, _ := c.openProgram(c.programFlags(args))
+	expr := runParseToExpr(source)
+	if hadError {
+		os.Exit(exitCompile)
+	}
+	fmt.Println(PrintAst(expr))
+}
+
+func evaluateCommand(c *command, args []string) {
+	source, _, _ := c.openProgram(c.programFlags(args))
+	expr := runParseToExpr(source)
+	if hadError {
+		os.Exit(exitCompile)
+	}
+	InterpretExpr(expr)
+	if exitStatus >= 0 {
+		os.Exit(exitStatus)
+	}
+	if hadRuntimeError {
+		os.Exit(exitRuntime)
+	}
+}
+
+func runCommand(c *command, args []string) {
+	flags := c.flags()
+	optimize := flags.Bool("O", false, "fold constant expressions and eliminate dead branches before running")
+	maxSteps := flags.Int("max-steps", 0, "stop after executing this many statements and loop iterations (0 for no limit)")
+	timeout := flags.Duration("timeout", 0, "stop after running for this long, e.g. 5s (0 for no limit)")
+	virtualClock := flags.Bool("virtual-clock", false, "run timers without waiting for them, for reproducible output")
+	searchPath := flags.String("path", os.Getenv("LOXPATH"), "directories to search for imported files, separated by '"+string(os.PathListSeparator)+"' (default $LOXPATH)")
+	addInlineFlag(flags)
+	c.parse(flags, args)
+
+	source, filename, arguments := c.openProgram(flags)
+	_, parser, statements := parseFile(source, "", 0)
+	source.Close()
+	reportWarnings(parser.Warnings)
+	if hadError {
+		os.Exit(exitCompile)
+	}
+	if *optimize {
+		statements = Optimize(statements)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+
+	interpreter := NewInterpreter()
+	interpreter.Context = ctx
+	interpreter.MaxSteps = *maxSteps
+	interpreter.Timeout = *timeout
+	interpreter.VirtualClock = *virtualClock
+	interpreter.Spans = parser.Spans
+	interpreter.MainFile = filename
+	interpreter.LastId = parser.LastId
+	if *searchPath != "" {
+		interpreter.SearchPath = filepath.SplitList(*searchPath)
+	}
+	interpreter.Args = argumentList(arguments)
+	interpreter.Globals.define("args", ObjectValue(interpreter.Args))
+	interpreter.InterpretStatements(statements)
+	if exitStatus >= 0 {
+		os.Exit(exitStatus)
+	}
+	if hadRuntimeError {
+		os.Exit(exitRuntime)
+	}
+	if wasInterrupted {
+		os.Exit(exitInterrupted)
+	}
+	if hadHaltError {
+		os.Exit(exitHalted)
+	}
+}
+
+func fmtCommand(c *command, args []string) {
+	flags := c.flags()
+	check := flags.Bool("check", false, "exit with status 1 if the file is not formatted")
+	write := flags.Bool("write", false, "write the formatted source back to the file")
+	c.parse(flags, args)
+	if flags.NArg() != 1 {
+		c.usageError("expected one file")
+	}
+	filename := flags.Arg(0)
+
+	source := readSource(filename)
+	formatted, err := formatSource(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		os.Exit(exitRuntime)
+	}
+	if hadError {
+		os.Exit(exitCompile)
+	}
+	switch {
+	case *check:
+		if formatted != source {
+			fmt.Fprintf(os.Stderr, "%s is not formatted\n", filename)
+			os.Exit(1)
 		}
-		InterpretStatements(statements)
-		if hadRuntimeError {
-			os.Exit(70)
+	case *write:
+		if formatted != source {
+			if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+				os.Exit(1)
+			}
 		}
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
+		fmt.Print(formatted)
+	}
+}
+
+func lintCommand(c *command, args []string) {
+	source, _, _ := c.openProgram(c.programFlags(args))
+	scanner, parser, statements := parseFile(source, "", 0)
+	source.Close()
+	if hadError {
+		os.Exit(exitCompile)
+	}
+	warnings := Lint(statements, parser, scanner.Comments)
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+	if len(warnings) > 0 {
 		os.Exit(1)
 	}
 }
 
-func runTokenize(filename string) []Token {
+func benchCommand(c *command, args []string) {
+	flags := c.flags()
+	runs := flags.Int("n", 5, "run each script this many times")
+	c.parse(flags, args)
+	if *runs < 1 {
+		c.usageError("-n must be at least 1")
+	}
+	if flags.NArg() == 0 {
+		c.usageError("missing script file")
+	}
+	runBenchmarks(flags.Args(), *runs)
+}
+
+func readSource(filename string) string {
 	fileContents, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitNoInput)
 	}
-	scanner := &Scanner{
-		Source:  string(fileContents),
-		Tokens:  []Token{},
-		Start:   0,
-		Current: 0,
-		Line:    1,
+	return string(fileContents)
+}
+
+func openSource(filename string) *os.File {
+	file, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(exitNoInput)
 	}
-	tokens := scanner.scanTokens()
-	return tokens
+	return file
 }
 
-func runParseToStatements(tokens []Token) []Stmt {
-	parser := &Parser{tokens, 0}
-	return parser.ParseToStatements()
+// The value of the args global.
+func argumentList(arguments []string) *List {
+	list := &List{make([]Value, len(arguments))}
+	for index, argument := range arguments {
+		list.Elements[index] = StringValue(argument)
+	}
+	return list
 }
 
-func runParseToExpr(tokens []Token) Expr {
-	parser := &Parser{tokens, 0}
-	return parser.ParseToExpr()
+// Prints each token as soon as it is scanned.
+func runTokenize(source io.Reader) {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	scanner := NewScanner(source, "")
+	for {
+		token := scanner.NextToken()
+		fmt.Fprintln(out, token)
+		if token.Type == EOF {
+			return
+		}
+	}
+}
+
+// Scans and parses a whole program, keeping the scanner and parser around for the comments and spans they collect.
+func parseProgram(source string) (*Scanner, *Parser, []Stmt) {
+	return parseFile(strings.NewReader(source), "", 0)
+}
+
+// Like parseProgram, reading the program as it is parsed. file is empty for the main file; node ids continue after
+// lastId.
+func parseFile(source io.Reader, file string, lastId int) (*Scanner, *Parser, []Stmt) {
+	scanner := NewScanner(source, file)
+	parser := &Parser{Tokens: scanner, LastId: lastId}
+	statements := parser.ParseToStatements()
+	Resolve(statements)
+	return scanner, parser, statements
 }
 
-func lineError(line int, message string) {
-	report(line, "", message)
+// Parses the single expression a program holds. The rest of it is still scanned, so errors in it are reported.
+func runParseToExpr(source io.ReadCloser) Expr {
+	defer source.Close()
+	scanner := NewScanner(source, "")
+	expr := (&Parser{Tokens: scanner}).ParseToExpr()
+	scanner.scanTokens()
+	if expr != nil {
+		ResolveExpr(expr)
+	}
+	return expr
+}
+
+func lineError(file string, line int, message string) {
+	report(Token{Line: line, File: file}, "", message, "")
 }
 
 func tokenError(token Token, message string) {
+	tokenErrorWithHint(token, message, "")
+}
+
+// The hint is only shown in annotated diagnostics.
+func tokenErrorWithHint(token Token, message, hint string) {
 	if token.Type == EOF {
-		report(token.Line, " at end", message)
+		report(token, " at end", message, hint)
 		return
 	}
-	report(token.Line, " at '"+token.Lexeme+"'", message)
+	report(token, " at '"+token.Lexeme+"'", message, hint)
 }
 
-func runtimeError(RuntimeError) {
-	// fmt.Println(err)
+func reportWarnings(warnings []Warning) {
+	for _, warning := range warnings {
+		if annotateDiagnostics {
+			annotate("warning["+warning.Rule+"]", warning.Token, warning.Message, "")
+			continue
+		}
+		fmt.Fprintln(os.Stderr, warning)
+	}
+}
+
+func runtimeError(err RuntimeError) {
+	if annotateDiagnostics {
+		annotate("error", err.Token, err.Message, "")
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	hadRuntimeError = true
+}
+
+// Reports an exception that no catch clause handled.
+// Rethrown runtime errors are reported as they would have been had they never been caught.
+func uncaughtException(err ThrowError) {
+	if loxError, ok := err.Value.AsObject().(*LoxError); ok {
+		runtimeError(RuntimeError{Token{Line: loxError.Line, File: loxError.File}, loxError.Message})
+		return
+	}
+	if annotateDiagnostics {
+		annotate("error", err.Token, fmt.Sprintf("Uncaught exception: %s", err.Value), "")
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
 	hadRuntimeError = true
 }
 
-func report(line int, where, message string) {
-	fmt.Fprintf(os.Stderr, "[line %d] Error%s: %s\n", line, where, message)
+func haltError(err HaltError) {
+	fmt.Fprintln(os.Stderr, err)
+	hadHaltError = true
+	wasInterrupted = errors.Is(err.Cause, ErrInterrupted)
+}
+
+// Returns a context that is cancelled with ErrInterrupted on the first SIGINT.
+// The default handler is restored at that point, so a second SIGINT still kills the process.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel(ErrInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(nil)
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// where is shown in plain diagnostics, which do not quote the token.
+func report(token Token, where, message, hint string) {
+	if annotateDiagnostics {
+		annotate("error", token, message, hint)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s Error%s: %s\n", location(token.File, token.Line), where, message)
+	}
 	hadError = true
 }
 
-func print(tokens []Token) {
-	for _, token := range tokens {
-		fmt.Println(token)
+// Formats where a diagnostic comes from. The main file is not named, but stdin and -e source are.
+func location(file string, line int) string {
+	if file == "" {
+		file = mainName
+	}
+	if file == "" {
+		return fmt.Sprintf("[line %d]", line)
 	}
+	return fmt.Sprintf("[%s line %d]", file, line)
 }
 
 func stringifyNumber(number float64, trailingZero bool) string {
@@ -116,7 +379,7 @@ func stringifyNumber(number float64, trailingZero bool) string {
 	return fmt.Sprintf("%v", number)
 }
 
-// Exposes additional in case we need to display things differently.
+// Displays the literals of tokens and expressions. Runtime values are displayed by Value.String.
 func stringify(literal any, nilName string, trailingZero bool) string {
 	switch l := literal.(type) {
 	case float64:
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A file loaded by an import statement. Its top-level declarations live in a global environment of its own, and only
+// the exported ones can be reached from outside, as properties of the module.
+type Module struct {
+	// The file as shown in diagnostics.
+	File    string
+	Globals *Environment
+	Exports map[string]bool
+	// The module whose import loaded this one, or nil for the main file.
+	importer *Module
+	// Closed once the module has finished running, with err set if it failed.
+	done chan struct{}
+	err  error
+}
+
+func (m *Module) String() string {
+	return "<module " + m.File + ">"
+}
+
+func (m *Module) Type() string {
+	return "module"
+}
+
+// The state of the imports of a program. The zero value is ready to use.
+type moduleLoader struct {
+	moduleLock sync.Mutex
+	// Every module imported so far, by absolute path, including the main file.
+	modules map[string]*Module
+}
+
+// Returns the module stmt imports, loading and running it the first time it is imported.
+func (i *Interpreter) importModule(stmt *Import) (*Module, error) {
+	name := stmt.Path.Literal.(string)
+	path, ok := i.resolveImport(name, stmt.Path.File)
+	if !ok {
+		return nil, RuntimeError{stmt.Path, "Cannot find module '" + name + "'."}
+	}
+
+	i.moduleLock.Lock()
+	importer := i.moduleOf(stmt.Keyword.File)
+	module, loaded := i.modules[path]
+	if !loaded {
+		module = &Module{File: displayPath(path), importer: importer, done: make(chan struct{})}
+		i.modules[path] = module
+	}
+	i.moduleLock.Unlock()
+
+	if !loaded {
+		module.err = i.runModule(module, path, stmt)
+		close(module.done)
+		return module, module.err
+	}
+	select {
+	case <-module.done:
+		return module, module.err
+	default:
+	}
+	if cycle := importCycle(importer, module); cycle != "" {
+		return nil, RuntimeError{stmt.Path, "Import cycle: " + cycle + "."}
+	}
+	// Another task is running the module; wait for it rather than running it twice.
+	_, _, _, err := i.block([]reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(module.done)}}, true)
+	if err != nil {
+		return nil, locate(err, stmt.Keyword)
+	}
+	return module, module.err
+}
+
+// Returns the module of the file tokens were read from, registering the main file on first use.
+// Must be called with the module lock held.
+func (i *Interpreter) moduleOf(file string) *Module {
+	if i.modules == nil {
+		i.modules = make(map[string]*Module)
+		main := &Module{File: i.MainFile, done: make(chan struct{})}
+		if path, err := filepath.Abs(i.MainFile); err == nil && i.MainFile != "" {
+			i.modules[path] = main
+		}
+		i.modules[""] = main
+	}
+	if file == "" {
+		return i.modules[""]
+	}
+	path, _ := filepath.Abs(file)
+	return i.modules[path]
+}
+
+// Describes the chain of imports from module back to importer, if module is one of the files importer is being
+// imported by, like "a.lox -> b.lox -> a.lox".
+func importCycle(importer, module *Module) string {
+	chain := []string{}
+	for m := importer; m != nil; m = m.importer {
+		chain = append([]string{displayName(m)}, chain...)
+		if m == module {
+			return strings.Join(append(chain, displayName(module)), " -> ")
+		}
+	}
+	return ""
+}
+
+func displayName(m *Module) string {
+	if m.File == "" {
+		return "<main>"
+	}
+	return m.File
+}
+
+// Looks for name next to the importing file first, then in each directory of the search path.
+func (i *Interpreter) resolveImport(name, importingFile string) (string, bool) {
+	if importingFile == "" {
+		importingFile = i.MainFile
+	}
+	directories := []string{filepath.Dir(importingFile)}
+	if filepath.IsAbs(name) {
+		directories = []string{""}
+	} else {
+		directories = append(directories, i.SearchPath...)
+	}
+	for _, directory := range directories {
+		path, err := filepath.Abs(filepath.Join(directory, name))
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Paths are shown relative to the working directory when they are below it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	relative, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return path
+	}
+	return relative
+}
+
+// Parses the module and runs its top-level statements in a global environment of its own.
+func (i *Interpreter) runModule(module *Module, path string, stmt *Import) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return RuntimeError{stmt.Path, "Cannot read module '" + module.File + "'."}
+	}
+	defer source.Close()
+
+	i.moduleLock.Lock()
+	hadErrorBefore := hadError
+	hadError = false
+	_, parser, statements := parseFile(source, module.File, i.LastId)
+	failed := hadError
+	hadError = hadError || hadErrorBefore
+	i.LastId = parser.LastId
+	i.moduleLock.Unlock()
+	reportWarnings(parser.Warnings)
+	if failed {
+		return RuntimeError{stmt.Path, "Module '" + module.File + "' has errors."}
+	}
+	i.addSpans(parser.Spans)
+
+	module.Exports = make(map[string]bool)
+	for _, statement := range statements {
+		if export, ok := statement.(*Export); ok {
+			module.Exports[declaredName(export.Declaration).Lexeme] = true
+		}
+	}
+	module.Globals = NewEnvironment(nil)
+	defineNatives(module.Globals)
+	if i.Args != nil {
+		module.Globals.define("args", ObjectValue(i.Args))
+	}
+	child := &Interpreter{Environment: module.Globals, Globals: module.Globals, Runtime: i.Runtime}
+	for _, statement := range statements {
+		if evalResult := child.execute(statement); evalResult.Err != nil {
+			return evalResult.Err
+		}
+	}
+	return nil
+}
+
+// The name a declaration that can be exported declares.
+func declaredName(stmt Stmt) Token {
+	switch s := stmt.(type) {
+	case *Var:
+		return s.Name
+	case *Generator:
+		return s.Name
+	}
+	return Token{}
+}
+
+// Reads an exported name of a module.
+func (m *Module) get(name Token) (Value, error) {
+	if !m.Exports[name.Lexeme] {
+		message := "Module '" + m.File + "' does not export '" + name.Lexeme + "'."
+		if suggestion := closestName(name.Lexeme, sortedNames(m.Exports)); suggestion != "" {
+			message += " Did you mean '" + suggestion + "'?"
+		}
+		return Nil, RuntimeError{name, message}
+	}
+	return m.Globals.getGlobal(Binding{Slot: globalNames.intern(name.Lexeme)}, name)
+}
@@ -0,0 +1,12 @@
+package main
+
+// Node is embedded in every generated Expr and Stmt.
+// The Parser hands out ids in parse order, so they are unique within a parse and stable across runs,
+// which lets passes keep side tables keyed by node.
+type Node struct {
+	Id int
+}
+
+func (n Node) NodeId() int {
+	return n.Id
+}
@@ -0,0 +1,337 @@
+package main
+
+// Rewrites the AST before it is interpreted.
+// Constant subtrees are folded by evaluating them with the interpreter itself, so folding can never disagree with
+// runtime semantics, and any subtree whose evaluation fails is left untouched so the error still happens at runtime,
+// with the same token. Replacement nodes reuse the id of the node they replace.
+//
+// Expression visitors return an Expr; statement visitors return a Stmt, or nil when the statement can be dropped.
+type Optimizer struct {
+	folder Interpreter
+}
+
+func Optimize(statements []Stmt) []Stmt {
+	return (&Optimizer{}).statements(statements)
+}
+
+func (o *Optimizer) statements(statements []Stmt) []Stmt {
+	optimized := []Stmt{}
+	for _, statement := range statements {
+		if statement = o.stmt(statement); statement != nil {
+			optimized = append(optimized, statement)
+		}
+	}
+	return optimized
+}
+
+func (o *Optimizer) stmt(stmt Stmt) Stmt {
+	optimized, _ := stmt.Accept(o).(Stmt)
+	return optimized
+}
+
+// Like stmt, for places where the grammar requires a statement to be present.
+func (o *Optimizer) body(stmt Stmt) Stmt {
+	if optimized := o.stmt(stmt); optimized != nil {
+		return optimized
+	}
+	return &Block{Node{stmt.NodeId()}, []Stmt{}}
+}
+
+func (o *Optimizer) expr(expr Expr) Expr {
+	return expr.Accept(o).(Expr)
+}
+
+// Replaces expr with its value when it evaluates without error.
+func (o *Optimizer) fold(expr Expr) Expr {
+	evalResult := o.folder.evaluate(expr)
+	if evalResult.Err != nil {
+		return expr
+	}
+	return &Literal{Node{expr.NodeId()}, evalResult.Value.Interface(), exprToken(expr)}
+}
+
+func (o *Optimizer) VisitBlockStmt(stmt *Block) any {
+	return &Block{stmt.Node, o.statements(stmt.Statements)}
+}
+
+func (o *Optimizer) VisitExportStmt(stmt *Export) any {
+	return &Export{stmt.Node, stmt.Keyword, o.stmt(stmt.Declaration)}
+}
+
+func (o *Optimizer) VisitExpressionStmt(stmt *Expression) any {
+	expression := o.expr(stmt.Expression)
+	if _, ok := expression.(*Literal); ok {
+		return nil
+	}
+	return &Expression{stmt.Node, expression}
+}
+
+func (o *Optimizer) VisitForStmt(stmt *For) any {
+	var initializer Stmt
+	if stmt.Initializer != nil {
+		initializer = o.stmt(stmt.Initializer)
+	}
+	var condition Expr
+	if stmt.Condition != nil {
+		condition = o.expr(stmt.Condition)
+		if literal, ok := condition.(*Literal); ok {
+			if !isTruthy(literal.Value) {
+				if initializer == nil {
+					return nil
+				}
+				return &Block{stmt.Node, []Stmt{initializer}}
+			}
+			condition = nil
+		}
+	}
+	var increment Expr
+	if stmt.Increment != nil {
+		increment = o.expr(stmt.Increment)
+	}
+	return &For{stmt.Node, initializer, condition, increment, o.body(stmt.Body)}
+}
+
+func (o *Optimizer) VisitForInStmt(stmt *ForIn) any {
+	return &ForIn{stmt.Node, stmt.Name, stmt.In, o.expr(stmt.Iterable), o.body(stmt.Body)}
+}
+
+func (o *Optimizer) VisitGeneratorStmt(stmt *Generator) any {
+	return &Generator{stmt.Node, stmt.Name, stmt.Params, o.body(stmt.Body)}
+}
+
+func (o *Optimizer) VisitIfStmt(stmt *If) any {
+	condition := o.expr(stmt.Condition)
+	if literal, ok := condition.(*Literal); ok {
+		if isTruthy(literal.Value) {
+			return o.stmt(stmt.ThenBranch)
+		}
+		if stmt.ElseBranch != nil {
+			return o.stmt(stmt.ElseBranch)
+		}
+		return nil
+	}
+	var elseBranch Stmt
+	if stmt.ElseBranch != nil {
+		elseBranch = o.stmt(stmt.ElseBranch)
+	}
+	return &If{stmt.Node, condition, o.body(stmt.ThenBranch), elseBranch}
+}
+
+func (o *Optimizer) VisitImportStmt(stmt *Import) any {
+	return stmt
+}
+
+func (o *Optimizer) VisitMatchStmt(stmt *Match) any {
+	cases := []MatchCase{}
+	for _, matchCase := range stmt.Cases {
+		patterns := []Pattern{}
+		for _, pattern := range matchCase.Patterns {
+			optimized := Pattern{o.expr(pattern.Value), pattern.Operator, nil}
+			if pattern.End != nil {
+				optimized.End = o.expr(pattern.End)
+			}
+			patterns = append(patterns, optimized)
+		}
+		cases = append(cases, MatchCase{patterns, o.body(matchCase.Body)})
+	}
+	var defaultBody Stmt
+	if stmt.Default != nil {
+		defaultBody = o.body(stmt.Default)
+	}
+	return &Match{stmt.Node, stmt.Keyword, o.expr(stmt.Subject), cases, defaultBody}
+}
+
+func (o *Optimizer) VisitPrintStmt(stmt *Print) any {
+	return &Print{stmt.Node, o.expr(stmt.Expression)}
+}
+
+func (o *Optimizer) VisitSelectStmt(stmt *Select) any {
+	cases := []SelectCase{}
+	for _, selectCase := range stmt.Cases {
+		optimized := SelectCase{selectCase.Name, selectCase.Operation, o.expr(selectCase.Channel), nil, o.body(selectCase.Body)}
+		if selectCase.Value != nil {
+			optimized.Value = o.expr(selectCase.Value)
+		}
+		cases = append(cases, optimized)
+	}
+	var defaultBody Stmt
+	if stmt.Default != nil {
+		defaultBody = o.body(stmt.Default)
+	}
+	return &Select{stmt.Node, stmt.Keyword, cases, defaultBody}
+}
+
+func (o *Optimizer) VisitThrowStmt(stmt *Throw) any {
+	return &Throw{stmt.Node, stmt.Keyword, o.expr(stmt.Value)}
+}
+
+func (o *Optimizer) VisitTryStmt(stmt *Try) any {
+	var catchBody, finallyBody Stmt
+	if stmt.CatchBody != nil {
+		catchBody = o.body(stmt.CatchBody)
+	}
+	if stmt.FinallyBody != nil {
+		finallyBody = o.body(stmt.FinallyBody)
+	}
+	return &Try{stmt.Node, o.body(stmt.Body), stmt.CatchName, catchBody, finallyBody}
+}
+
+func (o *Optimizer) VisitVarStmt(stmt *Var) any {
+	var initializer Expr
+	if stmt.Initializer != nil {
+		initializer = o.expr(stmt.Initializer)
+	}
+	return &Var{stmt.Node, stmt.Keyword, stmt.Name, initializer}
+}
+
+func (o *Optimizer) VisitWhileStmt(stmt *While) any {
+	condition := o.expr(stmt.Condition)
+	if literal, ok := condition.(*Literal); ok && !isTruthy(literal.Value) {
+		return nil
+	}
+	return &While{stmt.Node, condition, o.body(stmt.Body)}
+}
+
+func (o *Optimizer) VisitYieldStmt(stmt *Yield) any {
+	return &Yield{stmt.Node, stmt.Keyword, o.expr(stmt.Value)}
+}
+
+func (o *Optimizer) VisitAssignExpr(expr *Assign) any {
+	return &Assign{expr.Node, expr.Name, o.expr(expr.Value), expr.Binding}
+}
+
+func (o *Optimizer) VisitBinaryExpr(expr *Binary) any {
+	optimized := &Binary{expr.Node, o.expr(expr.Left), expr.Operator, o.expr(expr.Right)}
+	_, leftIsLiteral := optimized.Left.(*Literal)
+	_, rightIsLiteral := optimized.Right.(*Literal)
+	if leftIsLiteral && rightIsLiteral {
+		return o.fold(optimized)
+	}
+	return optimized
+}
+
+func (o *Optimizer) VisitCallExpr(expr *Call) any {
+	arguments := []Expr{}
+	for _, argument := range expr.Arguments {
+		arguments = append(arguments, o.expr(argument))
+	}
+	return &Call{expr.Node, o.expr(expr.Callee), expr.Paren, arguments}
+}
+
+func (o *Optimizer) VisitConditionalExpr(expr *Conditional) any {
+	condition := o.expr(expr.Condition)
+	thenBranch := o.expr(expr.ThenBranch)
+	elseBranch := o.expr(expr.ElseBranch)
+	if literal, ok := condition.(*Literal); ok {
+		if isTruthy(literal.Value) {
+			return thenBranch
+		}
+		return elseBranch
+	}
+	return &Conditional{expr.Node, condition, expr.Operator, thenBranch, elseBranch}
+}
+
+func (o *Optimizer) VisitGetExpr(expr *Get) any {
+	return &Get{expr.Node, o.expr(expr.Object), expr.Name}
+}
+
+func (o *Optimizer) VisitGroupingExpr(expr *Grouping) any {
+	expression := o.expr(expr.Expression)
+	if _, ok := expression.(*Literal); ok {
+		return expression
+	}
+	return &Grouping{expr.Node, expression}
+}
+
+func (o *Optimizer) VisitLambdaExpr(expr *Lambda) any {
+	return &Lambda{expr.Node, o.body(expr.Body)}
+}
+
+func (o *Optimizer) VisitLiteralExpr(expr *Literal) any {
+	return expr
+}
+
+// A literal left operand decides the result on its own, which is either that literal or the right operand.
+func (o *Optimizer) VisitLogicalExpr(expr *Logical) any {
+	left := o.expr(expr.Left)
+	right := o.expr(expr.Right)
+	if literal, ok := left.(*Literal); ok {
+		decided := isTruthy(literal.Value) == (expr.Operator.Type == OR)
+		if expr.Operator.Type == QUESTION_QUESTION {
+			decided = literal.Value != nil
+		}
+		if decided {
+			return left
+		}
+		return right
+	}
+	return &Logical{expr.Node, left, expr.Operator, right}
+}
+
+func (o *Optimizer) VisitRangeExpr(expr *Range) any {
+	optimized := &Range{expr.Node, o.expr(expr.Start), expr.Operator, o.expr(expr.End), nil}
+	if expr.Step != nil {
+		optimized.Step = o.expr(expr.Step)
+	}
+	return optimized
+}
+
+func (o *Optimizer) VisitSpawnExpr(expr *Spawn) any {
+	return &Spawn{expr.Node, expr.Keyword, o.body(expr.Body)}
+}
+
+func (o *Optimizer) VisitUnaryExpr(expr *Unary) any {
+	right := o.expr(expr.Right)
+	if _, ok := right.(*Literal); ok {
+		return o.fold(&Unary{expr.Node, expr.Operator, right})
+	}
+
+	if expr.Operator.Type == BANG {
+		operand := ungroup(right)
+		// !(a == b) -> a != b and !(a != b) -> a == b.
+		if binary, ok := operand.(*Binary); ok && (binary.Operator.Type == EQUAL_EQUAL || binary.Operator.Type == BANG_EQUAL) {
+			negated := binary.Operator
+			negated.Type, negated.Lexeme = BANG_EQUAL, "!="
+			if binary.Operator.Type == BANG_EQUAL {
+				negated.Type, negated.Lexeme = EQUAL_EQUAL, "=="
+			}
+			return &Binary{expr.Node, binary.Left, negated, binary.Right}
+		}
+		// !!a -> a, when a already evaluates to a boolean.
+		if unary, ok := operand.(*Unary); ok && unary.Operator.Type == BANG && isBoolean(unary.Right) {
+			return unary.Right
+		}
+	}
+	return &Unary{expr.Node, expr.Operator, right}
+}
+
+func (o *Optimizer) VisitVariableExpr(expr *Variable) any {
+	return expr
+}
+
+func ungroup(expr Expr) Expr {
+	for {
+		grouping, ok := expr.(*Grouping)
+		if !ok {
+			return expr
+		}
+		expr = grouping.Expression
+	}
+}
+
+// Reports whether expr always evaluates to a boolean, whenever it evaluates without error.
+func isBoolean(expr Expr) bool {
+	switch e := ungroup(expr).(type) {
+	case *Literal:
+		_, ok := e.Value.(bool)
+		return ok
+	case *Unary:
+		return e.Operator.Type == BANG
+	case *Binary:
+		switch e.Operator.Type {
+		case BANG_EQUAL, EQUAL_EQUAL, GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Runs a program the way the run command does, with or without -O, and returns what it printed and the errors it
+// reported.
+func runSource(t *testing.T, source string, optimize bool) (output string, errors string) {
+	t.Helper()
+	_, parser, statements := parseProgram(source)
+	if hadError {
+		t.Fatalf("%q does not parse", source)
+	}
+	if optimize {
+		statements = Optimize(statements)
+	}
+
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+	realStderr := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = realStderr }()
+	defer func() { hadRuntimeError = false }()
+
+	var out strings.Builder
+	interpreter := NewInterpreter()
+	interpreter.Out = bufio.NewWriter(&out)
+	interpreter.Spans = parser.Spans
+	interpreter.LastId = parser.LastId
+	interpreter.InterpretStatements(statements)
+
+	reported, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), string(reported)
+}
+
+// Optimizing must not change what a program prints, nor which errors it reports and on which line.
+func TestOptimizeKeepsBehavior(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		output string
+		errors string
+	}{
+		{
+			name:   "failing fold stays a runtime error",
+			source: "print 1;\nprint -\"x\";\n",
+			output: "1\n",
+			errors: "Operand of '-' must be a number, got string \"x\".\n[line 2]\n",
+		},
+		{
+			name:   "if true",
+			source: "if (true) print \"then\"; else print \"else\";\nif (false) print \"then\"; else print \"else\";\nif (false) print \"never\";\n",
+			output: "then\nelse\n",
+		},
+		{
+			name:   "while false",
+			source: "var a = 1;\nwhile (false) a = a + 1;\nprint a;\n",
+			output: "1\n",
+		},
+		{
+			name:   "for with a false condition keeps its initializer",
+			source: "{\n  var a = \"a\";\n  var note = { print \"init\"; };\n  for (var i = note(); false; i = i + \"!\") print i;\n  var b = \"b\";\n  var f = { print a + b; };\n  f();\n}\n",
+			output: "init\nab\n",
+		},
+		{
+			name:   "for with a false condition and no initializer",
+			source: "{\n  var a = 1;\n  for (; false;) print a;\n  var b = 2;\n  print a + b;\n}\n",
+			output: "3\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, errors := runSource(t, test.source, false)
+			if output != test.output || errors != test.errors {
+				t.Fatalf("run printed %q and reported %q, want %q and %q", output, errors, test.output, test.errors)
+			}
+			optimizedOutput, optimizedErrors := runSource(t, test.source, true)
+			if optimizedOutput != output || optimizedErrors != errors {
+				t.Errorf("run -O printed %q and reported %q, want %q and %q", optimizedOutput, optimizedErrors, output, errors)
+			}
+		})
+	}
+}
@@ -1,10 +1,56 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+)
+
+// Where the parser pulls its tokens from, one at a time. Scanner is the only implementation.
+type TokenSource interface {
+	NextToken() Token
+}
 
 type Parser struct {
-	Tokens  []Token
-	Current int
+	Tokens TokenSource
+	// The tokens pulled from Tokens but not consumed yet, and the last one consumed.
+	ahead []Token
+	last  Token
+	// The id of the most recently created node.
+	LastId int
+	// The tokens each statement was parsed from, keyed by node id.
+	Spans map[int]Span
+	// Problems that do not stop the program from being parsed.
+	Warnings []Warning
+	// Whether the statements being parsed are the body of a generator, the only place yield is allowed.
+	InGenerator bool
+	// How many blocks deep the parser is, zero for top-level statements.
+	Depth int
+}
+
+type Span struct {
+	Start Token
+	End   Token
+}
+
+type MatchCase struct {
+	Patterns []Pattern
+	Body     Stmt
+}
+
+// Either a single value, or a range of numbers when Operator is ".." (inclusive) or "..<" (exclusive).
+type Pattern struct {
+	Value    Expr
+	Operator Token
+	End      Expr
+}
+
+// A send when Value is set, otherwise a receive, whose value is bound to Name when there is one.
+type SelectCase struct {
+	Name      Token
+	Operation Token
+	Channel   Expr
+	Value     Expr
+	Body      Stmt
 }
 
 var ErrParse = fmt.Errorf("ParseError")
@@ -32,16 +78,43 @@ func (p *Parser) expression() (Expr, error) {
 	return p.assignment()
 }
 
-func (p *Parser) declaration() Stmt {
-	if p.match(VAR) {
-		stmt, err := p.varDeclaration()
+func (p *Parser) declaration() (stmt Stmt) {
+	defer p.recordSpan(p.peek(), &stmt)
+
+	var err error
+	if p.match(EXPORT) {
+		stmt, err = p.exportDeclaration()
 		if err != nil {
 			p.synchronize()
 			return nil
 		}
 		return stmt
 	}
-	stmt, err := p.statement()
+	if p.match(IMPORT) {
+		stmt, err = p.importDeclaration()
+		if err != nil {
+			p.synchronize()
+			return nil
+		}
+		return stmt
+	}
+	if p.match(FUN) {
+		stmt, err = p.generatorDeclaration()
+		if err != nil {
+			p.synchronize()
+			return nil
+		}
+		return stmt
+	}
+	if p.match(VAR, CONST) {
+		stmt, err = p.varDeclaration()
+		if err != nil {
+			p.synchronize()
+			return nil
+		}
+		return stmt
+	}
+	stmt, err = p.statement()
 	if err != nil {
 		p.synchronize()
 		return nil
@@ -49,29 +122,54 @@ func (p *Parser) declaration() Stmt {
 	return stmt
 }
 
-// statement -> exprStmt | forStmt | ifStmt | printStmt | whileStmt | block
-func (p *Parser) statement() (Stmt, error) {
+// statement -> exprStmt | forStmt | ifStmt | matchStmt | printStmt | selectStmt | throwStmt | tryStmt | whileStmt |
+// yieldStmt | block
+func (p *Parser) statement() (stmt Stmt, err error) {
+	defer p.recordSpan(p.peek(), &stmt)
+
 	if p.match(FOR) {
 		return p.forStatement()
 	}
 	if p.match(IF) {
 		return p.ifStatement()
 	}
+	if p.atMatchStatement() {
+		p.advance()
+		return p.matchStatement()
+	}
 	if p.match(PRINT) {
 		return p.printStatement()
 	}
+	if p.checkWord("select") && p.peekAt(1).Type == LEFT_BRACE {
+		p.advance()
+		return p.selectStatement()
+	}
+	if p.match(THROW) {
+		return p.throwStatement()
+	}
+	if p.match(TRY) {
+		return p.tryStatement()
+	}
 	if p.match(WHILE) {
 		return p.whileStatement()
 	}
+	if p.match(YIELD) {
+		return p.yieldStatement()
+	}
 	if p.match(LEFT_BRACE) {
-		return Block{p.block()}, nil
+		return &Block{p.node(), p.block()}, nil
 	}
 	return p.expressionStatement()
 }
 
 // forStmt -> "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+// forStmt -> "for" "(" "var" IDENTIFIER "in" expression ")" statement ;
+// "in" is only a keyword here.
 func (p *Parser) forStatement() (Stmt, error) {
 	p.consume(LEFT_PAREN, "Expect '(' after 'for'.")
+	if in := p.peekAt(2); p.check(VAR) && in.Type == IDENTIFIER && in.Lexeme == "in" {
+		return p.forInStatement()
+	}
 
 	var initializer Stmt
 	var err error
@@ -113,20 +211,26 @@ func (p *Parser) forStatement() (Stmt, error) {
 		return nil, err
 	}
 
-	if increment != nil {
-		body = Block{[]Stmt{body, Expression{increment}}}
-	}
+	return &For{p.node(), initializer, condition, increment, body}, nil
+}
 
-	if condition == nil {
-		condition = Literal{true}
+func (p *Parser) forInStatement() (Stmt, error) {
+	p.advance()
+	name, err := p.consume(IDENTIFIER, "Expect variable name.")
+	if err != nil {
+		return nil, err
 	}
-	body = While{condition, body}
-
-	if initializer != nil {
-		body = Block{[]Stmt{initializer, body}}
+	in := p.advance()
+	iterable, err := p.expression()
+	if err != nil {
+		return nil, err
 	}
-
-	return body, nil
+	p.consume(RIGHT_PAREN, "Expect ')' after for-in clause.")
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return &ForIn{p.node(), name, in, iterable, body}, nil
 }
 
 // ifStmt -> "if" "(" expression ")" statement ( "else" statement )?
@@ -150,7 +254,93 @@ func (p *Parser) ifStatement() (Stmt, error) {
 		}
 	}
 
-	return If{condition, thenBranch, elseBranch}, nil
+	return &If{p.node(), condition, thenBranch, elseBranch}, nil
+}
+
+// matchStmt -> "match" "(" expression ")" "{" matchCase* ( "default" ":" declaration* )? "}"
+// matchCase -> "case" pattern ( "," pattern )* ":" declaration*
+// "match", "case" and "default" are only keywords here, and in select statements.
+func (p *Parser) matchStatement() (Stmt, error) {
+	keyword := p.previous()
+	p.consume(LEFT_PAREN, "Expect '(' after 'match'.")
+	subject, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	p.consume(RIGHT_PAREN, "Expect ')' after match subject.")
+	p.consume(LEFT_BRACE, "Expect '{' before match cases.")
+
+	cases := []MatchCase{}
+	seen := make(map[any]bool)
+	for p.matchWord("case") {
+		patterns := []Pattern{}
+		for {
+			start := p.peek()
+			pattern, err := p.pattern()
+			if err != nil {
+				return nil, err
+			}
+			if pattern.End == nil {
+				// Folding lets '-1' or '1 + 1' count as the literals they are.
+				if literal, ok := (&Optimizer{}).expr(pattern.Value).(*Literal); ok {
+					if seen[literal.Value] {
+						p.Warnings = append(p.Warnings, Warning{ruleDuplicateCase, start, "Duplicate case value."})
+					}
+					seen[literal.Value] = true
+				}
+			}
+			patterns = append(patterns, pattern)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+		p.consume(COLON, "Expect ':' after case patterns.")
+		cases = append(cases, MatchCase{patterns, p.caseBody()})
+	}
+
+	var defaultBody Stmt
+	if p.matchWord("default") {
+		p.consume(COLON, "Expect ':' after 'default'.")
+		defaultBody = p.caseBody()
+	}
+	if p.atCase() {
+		return nil, parseError(p.peek(), "The default case must come last.")
+	}
+	p.consume(RIGHT_BRACE, "Expect '}' after match cases.")
+
+	return &Match{p.node(), keyword, subject, cases, defaultBody}, nil
+}
+
+// pattern -> term ( ( ".." | "..<" ) term )?
+func (p *Parser) pattern() (Pattern, error) {
+	value, err := p.term()
+	if err != nil {
+		return Pattern{}, err
+	}
+	if operator, ok := p.matchRangeOperator(); ok {
+		end, err := p.term()
+		if err != nil {
+			return Pattern{}, err
+		}
+		return Pattern{value, operator, end}, nil
+	}
+	return Pattern{Value: value}, nil
+}
+
+// The statements of a case run in their own scope, as if they were a block. A statement starting with the word "case"
+// or "default" starts the next case instead.
+func (p *Parser) caseBody() (stmt Stmt) {
+	defer p.recordSpan(p.peek(), &stmt)
+
+	p.Depth++
+	defer func() { p.Depth-- }()
+	statements := []Stmt{}
+	for !p.atCase() && !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		if statement := p.declaration(); statement != nil {
+			statements = append(statements, statement)
+		}
+	}
+	return &Block{p.node(), statements}
 }
 
 // printStmt -> "print" expression ";"
@@ -160,15 +350,204 @@ func (p *Parser) printStatement() (Stmt, error) {
 		return nil, err
 	}
 	p.consume(SEMICOLON, "Expect ';' after value.")
-	return Print{value}, nil
+	return &Print{p.node(), value}, nil
+}
+
+// selectStmt -> "select" "{" selectCase* ( "default" ":" declaration* )? "}"
+// selectCase -> "case" ( "var" IDENTIFIER "=" )? selectOp ":" declaration*
+// selectOp   -> "receive" "(" expression ")" | "send" "(" expression "," expression ")"
+func (p *Parser) selectStatement() (Stmt, error) {
+	keyword := p.previous()
+	p.consume(LEFT_BRACE, "Expect '{' after 'select'.")
+
+	cases := []SelectCase{}
+	for p.matchWord("case") {
+		var name Token
+		var err error
+		if p.match(VAR) {
+			name, err = p.consume(IDENTIFIER, "Expect variable name.")
+			if err != nil {
+				return nil, err
+			}
+			p.consume(EQUAL, "Expect '=' after variable name.")
+		}
+		operation, err := p.consume(IDENTIFIER, "Expect 'send' or 'receive' after 'case'.")
+		if err != nil {
+			return nil, err
+		}
+		if operation.Lexeme != "send" && operation.Lexeme != "receive" {
+			return nil, parseError(operation, "Expect 'send' or 'receive' after 'case'.")
+		}
+		if operation.Lexeme == "send" && name.Lexeme != "" {
+			return nil, parseError(operation, "Only a receive can declare a variable.")
+		}
+		p.consume(LEFT_PAREN, "Expect '(' after '"+operation.Lexeme+"'.")
+		channel, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		var value Expr
+		if operation.Lexeme == "send" {
+			p.consume(COMMA, "Expect ',' after channel.")
+			value, err = p.expression()
+			if err != nil {
+				return nil, err
+			}
+		}
+		p.consume(RIGHT_PAREN, "Expect ')' after arguments.")
+		p.consume(COLON, "Expect ':' after select case.")
+		cases = append(cases, SelectCase{name, operation, channel, value, p.caseBody()})
+	}
+
+	var defaultBody Stmt
+	if p.matchWord("default") {
+		p.consume(COLON, "Expect ':' after 'default'.")
+		defaultBody = p.caseBody()
+	}
+	if p.atCase() {
+		return nil, parseError(p.peek(), "The default case must come last.")
+	}
+	p.consume(RIGHT_BRACE, "Expect '}' after select cases.")
+
+	return &Select{p.node(), keyword, cases, defaultBody}, nil
+}
+
+// throwStmt -> "throw" expression ";"
+func (p *Parser) throwStatement() (Stmt, error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	p.consume(SEMICOLON, "Expect ';' after thrown value.")
+	return &Throw{p.node(), keyword, value}, nil
+}
+
+// tryStmt -> "try" block ( "catch" "(" IDENTIFIER ")" block )? ( "finally" block )?
+// At least one of the catch and finally clauses must be present.
+func (p *Parser) tryStatement() (Stmt, error) {
+	body, err := p.requiredBlock("Expect '{' after 'try'.")
+	if err != nil {
+		return nil, err
+	}
+
+	var catchName Token
+	var catchBody Stmt
+	if p.match(CATCH) {
+		p.consume(LEFT_PAREN, "Expect '(' after 'catch'.")
+		catchName, err = p.consume(IDENTIFIER, "Expect name of caught value.")
+		if err != nil {
+			return nil, err
+		}
+		p.consume(RIGHT_PAREN, "Expect ')' after caught value name.")
+		catchBody, err = p.requiredBlock("Expect '{' after catch clause.")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var finallyBody Stmt
+	if p.match(FINALLY) {
+		finallyBody, err = p.requiredBlock("Expect '{' after 'finally'.")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if catchBody == nil && finallyBody == nil {
+		return nil, parseError(p.peek(), "Expect 'catch' or 'finally' after try block.")
+	}
+	return &Try{p.node(), body, catchName, catchBody, finallyBody}, nil
+}
+
+// exportDecl -> "export" ( generatorDecl | varDecl )
+// Only top-level declarations make up the interface of a module.
+func (p *Parser) exportDeclaration() (Stmt, error) {
+	keyword := p.previous()
+	if p.Depth > 0 {
+		parseError(keyword, "Can only export top-level declarations.")
+	}
+	if !p.check(VAR) && !p.check(CONST) && !p.check(FUN) {
+		return nil, parseError(p.peek(), "Expect variable, constant or generator declaration after 'export'.")
+	}
+	declaration := p.declaration()
+	if declaration == nil {
+		// The declaration already reported its error and synchronized.
+		return nil, nil
+	}
+	return &Export{p.node(), keyword, declaration}, nil
+}
+
+// importDecl -> "import" STRING "as" IDENTIFIER ";"
+// "as" is only a keyword here, like "step".
+func (p *Parser) importDeclaration() (Stmt, error) {
+	keyword := p.previous()
+	path, err := p.consume(STRING, "Expect module path after 'import'.")
+	if err != nil {
+		return nil, err
+	}
+	if !p.checkWord("as") {
+		return nil, parseError(p.peek(), "Expect 'as' after module path.")
+	}
+	p.advance()
+	name, err := p.consume(IDENTIFIER, "Expect module name after 'as'.")
+	if err != nil {
+		return nil, err
+	}
+	p.consume(SEMICOLON, "Expect ';' after import.")
+	return &Import{p.node(), keyword, path, name}, nil
+}
+
+// generatorDecl -> "fun" "*" IDENTIFIER "(" parameters? ")" block
+// parameters    -> IDENTIFIER ( "," IDENTIFIER )*
+// Generators are the only kind of function so far.
+func (p *Parser) generatorDeclaration() (Stmt, error) {
+	if _, err := p.consume(STAR, "Expect '*' after 'fun', only generator functions are supported."); err != nil {
+		return nil, err
+	}
+	name, err := p.consume(IDENTIFIER, "Expect generator name.")
+	if err != nil {
+		return nil, err
+	}
+	p.consume(LEFT_PAREN, "Expect '(' after generator name.")
+	params := []Token{}
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(params) >= 255 {
+				parseError(p.peek(), "Can't have more than 255 parameters.")
+			}
+			param, err := p.consume(IDENTIFIER, "Expect parameter name.")
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(RIGHT_PAREN, "Expect ')' after parameters.")
+
+	enclosing := p.InGenerator
+	p.InGenerator = true
+	defer func() { p.InGenerator = enclosing }()
+	body, err := p.requiredBlock("Expect '{' before generator body.")
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{p.node(), name, params, body}, nil
 }
 
-// varDecl -> "var" IDENTIFIER ( "=" expression )? ";"
+// varDecl -> "var" IDENTIFIER ( "=" expression )? ";" | "const" IDENTIFIER "=" expression ";"
 func (p *Parser) varDeclaration() (Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(IDENTIFIER, "Expect variable name.")
 	if err != nil {
 		return nil, err
 	}
+	if keyword.Type == CONST && !p.check(EQUAL) {
+		return nil, parseError(p.peek(), "Expect '=' after constant name, constants must be initialized.")
+	}
 
 	var initializer Expr
 	if p.match(EQUAL) {
@@ -180,7 +559,7 @@ func (p *Parser) varDeclaration() (Stmt, error) {
 	}
 
 	p.consume(SEMICOLON, "Expect ';' after variable declaration.")
-	return Var{name, initializer}, nil
+	return &Var{p.node(), keyword, name, initializer}, nil
 }
 
 // whileStmt -> "while" "(" expression ")" statement
@@ -196,20 +575,53 @@ func (p *Parser) whileStatement() (Stmt, error) {
 		return nil, err
 	}
 
-	return While{condition, body}, nil
+	return &While{p.node(), condition, body}, nil
+}
+
+// yieldStmt -> "yield" expression ";"
+func (p *Parser) yieldStatement() (Stmt, error) {
+	keyword := p.previous()
+	if !p.InGenerator {
+		parseError(keyword, "Can't yield outside of a generator.")
+	}
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	p.consume(SEMICOLON, "Expect ';' after yielded value.")
+	return &Yield{p.node(), keyword, value}, nil
 }
 
 // exprStmt -> expression ";"
 func (p *Parser) expressionStatement() (Stmt, error) {
+	first := p.peek()
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
+	// A misspelled keyword, like "pirnt x;", is usually what makes a statement end too early.
+	if !p.check(SEMICOLON) && first.Type == IDENTIFIER {
+		if keyword := closestName(first.Lexeme, statementKeywordNames); keyword != "" {
+			return nil, parseError(first, "Expect statement. Did you mean '"+keyword+"'?")
+		}
+	}
 	p.consume(SEMICOLON, "Expect ';' after expression.")
-	return Expression{expr}, nil
+	return &Expression{p.node(), expr}, nil
+}
+
+// Parses a braced block in places where nothing else is allowed, like the clauses of a try statement.
+func (p *Parser) requiredBlock(message string) (stmt Stmt, err error) {
+	defer p.recordSpan(p.peek(), &stmt)
+
+	if _, err = p.consume(LEFT_BRACE, message); err != nil {
+		return nil, err
+	}
+	return &Block{p.node(), p.block()}, nil
 }
 
 func (p *Parser) block() []Stmt {
+	p.Depth++
+	defer func() { p.Depth-- }()
 	statements := []Stmt{}
 
 	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
@@ -222,9 +634,9 @@ func (p *Parser) block() []Stmt {
 	return statements
 }
 
-// assignment -> (IDENTIFIER "=" assignment) | logic_or
+// assignment -> (IDENTIFIER "=" assignment) | conditional
 func (p *Parser) assignment() (Expr, error) {
-	expr, err := p.or()
+	expr, err := p.conditional()
 	if err != nil {
 		return nil, err
 	}
@@ -236,8 +648,8 @@ func (p *Parser) assignment() (Expr, error) {
 			return nil, err
 		}
 
-		if varExpr, ok := expr.(Variable); ok {
-			return Assign{varExpr.Name, value}, nil
+		if varExpr, ok := expr.(*Variable); ok {
+			return &Assign{p.node(), varExpr.Name, value, Binding{}}, nil
 		}
 
 		parseError(equals, "Invalid assignment target.")
@@ -246,6 +658,52 @@ func (p *Parser) assignment() (Expr, error) {
 	return expr, nil
 }
 
+// conditional -> coalesce ( "?" expression ":" conditional )?
+func (p *Parser) conditional() (Expr, error) {
+	expr, err := p.coalesce()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.match(QUESTION) {
+		operator := p.previous()
+		thenBranch, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(COLON, "Expect ':' after then branch of conditional expression.")
+		if err != nil {
+			return nil, err
+		}
+		elseBranch, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		return &Conditional{p.node(), expr, operator, thenBranch, elseBranch}, nil
+	}
+
+	return expr, nil
+}
+
+// coalesce -> logic_or ( "??" logic_or )*
+func (p *Parser) coalesce() (Expr, error) {
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(QUESTION_QUESTION) {
+		operator := p.previous()
+		right, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		expr = &Logical{p.node(), expr, operator, right}
+	}
+
+	return expr, nil
+}
+
 // logic_or -> logic_and ( "or" logic_and )*
 func (p *Parser) or() (Expr, error) {
 	expr, err := p.and()
@@ -259,7 +717,7 @@ func (p *Parser) or() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Logical{expr, operator, right}
+		expr = &Logical{p.node(), expr, operator, right}
 	}
 
 	return expr, nil
@@ -278,7 +736,7 @@ func (p *Parser) and() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Logical{expr, operator, right}
+		expr = &Logical{p.node(), expr, operator, right}
 	}
 
 	return expr, nil
@@ -297,26 +755,52 @@ func (p *Parser) equality() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Binary{expr, operator, right}
+		expr = &Binary{p.node(), expr, operator, right}
 	}
 
 	return expr, nil
 }
 
-// comparison -> term ( (">" | ">=" | "<" | "<=") term )*
+// comparison -> range ( (">" | ">=" | "<" | "<=") range )*
 func (p *Parser) comparison() (Expr, error) {
-	expr, err := p.term()
+	expr, err := p.rangeExpr()
 	if err != nil {
 		return nil, err
 	}
 
 	for p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL) {
 		operator := p.previous()
-		right, err := p.term()
+		right, err := p.rangeExpr()
 		if err != nil {
 			return nil, err
 		}
-		expr = Binary{expr, operator, right}
+		expr = &Binary{p.node(), expr, operator, right}
+	}
+
+	return expr, nil
+}
+
+// range -> term ( (".." | "..<") term ( "step" term )? )?
+// "step" is only a keyword here, so it remains usable as a name everywhere else.
+func (p *Parser) rangeExpr() (Expr, error) {
+	expr, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	if operator, ok := p.matchRangeOperator(); ok {
+		end, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		var step Expr
+		if p.matchWord("step") {
+			step, err = p.term()
+			if err != nil {
+				return nil, err
+			}
+		}
+		expr = &Range{p.node(), expr, operator, end, step}
 	}
 
 	return expr, nil
@@ -335,7 +819,7 @@ func (p *Parser) term() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Binary{expr, operator, right}
+		expr = &Binary{p.node(), expr, operator, right}
 	}
 
 	return expr, nil
@@ -354,13 +838,13 @@ func (p *Parser) factor() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = Binary{expr, operator, right}
+		expr = &Binary{p.node(), expr, operator, right}
 	}
 
 	return expr, nil
 }
 
-// unary -> ( ("!" | "-") unary ) | primary
+// unary -> ( ("!" | "-") unary ) | call
 func (p *Parser) unary() (Expr, error) {
 	if p.match(BANG, MINUS) {
 		operator := p.previous()
@@ -368,28 +852,87 @@ func (p *Parser) unary() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Unary{operator, right}, nil
+		return &Unary{p.node(), operator, right}, nil
+	}
+
+	return p.call()
+}
+
+// call -> primary ( "(" arguments? ")" | "." IDENTIFIER )*
+func (p *Parser) call() (Expr, error) {
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.match(LEFT_PAREN) {
+			expr, err = p.finishCall(expr)
+			if err != nil {
+				return nil, err
+			}
+		} else if !p.atRangeOperator() && p.match(DOT) {
+			name, err := p.consume(IDENTIFIER, "Expect property name after '.'.")
+			if err != nil {
+				return nil, err
+			}
+			expr = &Get{p.node(), expr, name}
+		} else {
+			break
+		}
 	}
 
-	return p.primary()
+	return expr, nil
 }
 
-// primary -> NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")"
+// arguments -> expression ( "," expression )*
+func (p *Parser) finishCall(callee Expr) (Expr, error) {
+	arguments := []Expr{}
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(arguments) >= 255 {
+				parseError(p.peek(), "Can't have more than 255 arguments.")
+			}
+			argument, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, argument)
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	paren, err := p.consume(RIGHT_PAREN, "Expect ')' after arguments.")
+	if err != nil {
+		return nil, err
+	}
+	return &Call{p.node(), callee, paren, arguments}, nil
+}
+
+// primary -> NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" | "spawn" block | block
 func (p *Parser) primary() (Expr, error) {
 	if p.match(FALSE) {
-		return Literal{false}, nil
+		return &Literal{p.node(), false, p.previous()}, nil
 	}
 	if p.match(TRUE) {
-		return Literal{true}, nil
+		return &Literal{p.node(), true, p.previous()}, nil
 	}
 	if p.match(NIL) {
-		return Literal{nil}, nil
+		return &Literal{p.node(), nil, p.previous()}, nil
 	}
 	if p.match(NUMBER, STRING) {
-		return Literal{p.previous().Literal}, nil
+		return &Literal{p.node(), p.previous().Literal, p.previous()}, nil
+	}
+	if p.checkWord("spawn") && p.peekAt(1).Type == LEFT_BRACE {
+		p.advance()
+		return p.spawn()
 	}
 	if p.match(IDENTIFIER) {
-		return Variable{p.previous()}, nil
+		return &Variable{p.node(), p.previous(), Binding{}}, nil
+	}
+	if p.check(LEFT_BRACE) {
+		return p.lambda()
 	}
 	if p.match(LEFT_PAREN) {
 		expr, err := p.expression()
@@ -400,12 +943,54 @@ func (p *Parser) primary() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Grouping{expr}, nil
+		return &Grouping{p.node(), expr}, nil
 	}
 
 	return nil, parseError(p.peek(), "Expect expression.")
 }
 
+// A spawned block runs on its own, so a yield in it could not belong to an enclosing generator.
+func (p *Parser) spawn() (Expr, error) {
+	keyword := p.previous()
+	enclosing := p.InGenerator
+	p.InGenerator = false
+	defer func() { p.InGenerator = enclosing }()
+	body, err := p.requiredBlock("Expect '{' after 'spawn'.")
+	if err != nil {
+		return nil, err
+	}
+	return &Spawn{p.node(), keyword, body}, nil
+}
+
+// A block used as a value runs whenever it is called, so a yield in it could not belong to an enclosing generator.
+func (p *Parser) lambda() (Expr, error) {
+	enclosing := p.InGenerator
+	p.InGenerator = false
+	defer func() { p.InGenerator = enclosing }()
+	body, err := p.requiredBlock("Expect '{' before block.")
+	if err != nil {
+		return nil, err
+	}
+	return &Lambda{p.node(), body}, nil
+}
+
+// Deferred by statement rules so that the span is known once the statement has been parsed.
+func (p *Parser) recordSpan(start Token, stmt *Stmt) {
+	if *stmt == nil {
+		return
+	}
+	if p.Spans == nil {
+		p.Spans = make(map[int]Span)
+	}
+	p.Spans[(*stmt).NodeId()] = Span{start, p.previous()}
+}
+
+// Allocates the identity for a new node.
+func (p *Parser) node() Node {
+	p.LastId++
+	return Node{p.LastId}
+}
+
 func (p *Parser) match(tokenTypes ...TokenType) bool {
 	for _, t := range tokenTypes {
 		if p.check(t) {
@@ -417,6 +1002,71 @@ func (p *Parser) match(tokenTypes ...TokenType) bool {
 	return false
 }
 
+// Checks for an identifier used as a keyword where it is one, like "step" in a range, which leaves it usable as a name
+// everywhere else.
+func (p *Parser) checkWord(word string) bool {
+	return p.check(IDENTIFIER) && p.peek().Lexeme == word
+}
+
+func (p *Parser) matchWord(word string) bool {
+	if p.checkWord(word) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// Whether "match" starts a match statement rather than an expression, like a call of a function named match: its
+// parenthesized subject is followed by a brace.
+func (p *Parser) atMatchStatement() bool {
+	if !p.checkWord("match") || p.peekAt(1).Type != LEFT_PAREN {
+		return false
+	}
+	depth := 0
+	for offset := 1; ; offset++ {
+		switch p.peekAt(offset).Type {
+		case LEFT_PAREN:
+			depth++
+		case RIGHT_PAREN:
+			depth--
+			if depth == 0 {
+				return p.peekAt(offset+1).Type == LEFT_BRACE
+			}
+		case EOF:
+			return false
+		}
+	}
+}
+
+func (p *Parser) atCase() bool {
+	return p.checkWord("case") || p.checkWord("default") && p.peekAt(1).Type == COLON
+}
+
+// ".." and "..<" are scanned as the dots and less-than sign they are written with, so that they only become operators
+// where a range can be. They are one when written without spaces.
+func (p *Parser) atRangeOperator() bool {
+	first, second := p.peekAt(0), p.peekAt(1)
+	return first.Type == DOT && second.Type == DOT && adjacent(first, second)
+}
+
+func (p *Parser) matchRangeOperator() (Token, bool) {
+	if !p.atRangeOperator() {
+		return Token{}, false
+	}
+	first := p.advance()
+	second := p.advance()
+	operator := Token{DOT_DOT, "..", nil, first.Line, first.Column, first.File}
+	if p.check(LESS) && adjacent(second, p.peek()) {
+		p.advance()
+		operator.Type, operator.Lexeme = DOT_DOT_LESS, "..<"
+	}
+	return operator, true
+}
+
+func adjacent(first, second Token) bool {
+	return first.File == second.File && first.Line == second.Line && first.Column+len(first.Lexeme) == second.Column
+}
+
 func (p *Parser) consume(tokenType TokenType, message string) (Token, error) {
 	if p.check(tokenType) {
 		return p.advance(), nil
@@ -434,7 +1084,8 @@ func (p *Parser) check(tokenType TokenType) bool {
 
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
-		p.Current++
+		p.last = p.peek()
+		p.ahead = p.ahead[1:]
 	}
 	return p.previous()
 }
@@ -444,11 +1095,20 @@ func (p *Parser) isAtEnd() bool {
 }
 
 func (p *Parser) peek() Token {
-	return p.Tokens[p.Current]
+	return p.peekAt(0)
+}
+
+// Looks offset tokens ahead of the current one, pulling them from Tokens as needed. The source keeps returning EOF
+// once it is exhausted, so this stops at the end.
+func (p *Parser) peekAt(offset int) Token {
+	for len(p.ahead) <= offset {
+		p.ahead = append(p.ahead, p.Tokens.NextToken())
+	}
+	return p.ahead[offset]
 }
 
 func (p *Parser) previous() Token {
-	return p.Tokens[p.Current-1]
+	return p.last
 }
 
 func parseError(token Token, message string) error {
@@ -465,8 +1125,7 @@ func (p *Parser) synchronize() {
 			return
 		}
 
-		switch p.peek().Type {
-		case CLASS, FUN, VAR, FOR, IF, WHILE, PRINT, RETURN:
+		if slices.Contains(statementKeywords, p.peek().Type) || p.atMatchStatement() || p.checkWord("select") && p.peekAt(1).Type == LEFT_BRACE {
 			return
 		}
 
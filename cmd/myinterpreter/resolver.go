@@ -0,0 +1,321 @@
+package main
+
+// Walks the parsed program before it runs, binding each variable to the slot of the local it refers to, or to its
+// interned name if it is global. Assignments to constants and constants declared twice in one scope are reported as
+// parse errors. Names it cannot see the declaration of, like globals declared further down, are taken to
+// be globals and left to the runtime, which checks them again.
+//
+// Scopes mirror the environments the interpreter creates, one for one.
+type Resolver struct {
+	// The innermost scope is last; the first one holds the globals.
+	Scopes []map[string]*variable
+	// How many locals each scope has declared, counting names declared again, which is the slot of the next one.
+	slots []int
+	// The locals in scope, and the ones that were when each scope in Scopes began.
+	locals      *localName
+	outerLocals []*localName
+}
+
+type variable struct {
+	Slot     int
+	Constant bool
+}
+
+func Resolve(statements []Stmt) {
+	r := &Resolver{}
+	r.beginScope()
+	r.statements(statements)
+}
+
+// Resolves an expression evaluated on its own, in the global scope.
+func ResolveExpr(expr Expr) {
+	r := &Resolver{}
+	r.beginScope()
+	r.expr(expr)
+}
+
+func (r *Resolver) beginScope() {
+	r.Scopes = append(r.Scopes, make(map[string]*variable))
+	r.slots = append(r.slots, 0)
+	r.outerLocals = append(r.outerLocals, r.locals)
+}
+
+func (r *Resolver) endScope() {
+	r.Scopes = r.Scopes[:len(r.Scopes)-1]
+	r.slots = r.slots[:len(r.slots)-1]
+	r.locals = r.outerLocals[len(r.outerLocals)-1]
+	r.outerLocals = r.outerLocals[:len(r.outerLocals)-1]
+}
+
+// Locals get the next slot of their scope, which is where the interpreter appends them. A name declared again gets a
+// new slot too, and refers to it from then on.
+func (r *Resolver) declare(name Token, constant bool) {
+	innermost := len(r.Scopes) - 1
+	scope := r.Scopes[innermost]
+	if existing, ok := scope[name.Lexeme]; ok && existing.Constant {
+		tokenError(name, "Cannot redeclare constant '"+name.Lexeme+"'.")
+	}
+	scope[name.Lexeme] = &variable{r.slots[innermost], constant}
+	r.slots[innermost]++
+	if innermost > 0 {
+		r.locals = &localName{name.Lexeme, r.locals}
+	}
+}
+
+// Returns where name is found from the innermost scope, and its declaration if the resolver has seen it.
+func (r *Resolver) resolve(name Token) (Binding, *variable) {
+	for index := len(r.Scopes) - 1; index >= 0; index-- {
+		declaration, ok := r.Scopes[index][name.Lexeme]
+		if !ok {
+			continue
+		}
+		if index == 0 {
+			break
+		}
+		return Binding{Local: true, Depth: len(r.Scopes) - 1 - index, Slot: declaration.Slot}, declaration
+	}
+	return Binding{Slot: globalNames.intern(name.Lexeme), Locals: r.locals}, r.Scopes[0][name.Lexeme]
+}
+
+func (r *Resolver) statements(statements []Stmt) {
+	for _, statement := range statements {
+		r.stmt(statement)
+	}
+}
+
+func (r *Resolver) stmt(stmt Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *Resolver) expr(expr Expr) {
+	expr.Accept(r)
+}
+
+func (r *Resolver) VisitBlockStmt(stmt *Block) any {
+	r.beginScope()
+	r.statements(stmt.Statements)
+	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitExportStmt(stmt *Export) any {
+	r.stmt(stmt.Declaration)
+	return nil
+}
+
+func (r *Resolver) VisitExpressionStmt(stmt *Expression) any {
+	r.expr(stmt.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitForStmt(stmt *For) any {
+	r.beginScope()
+	if stmt.Initializer != nil {
+		r.stmt(stmt.Initializer)
+	}
+	if stmt.Condition != nil {
+		r.expr(stmt.Condition)
+	}
+	if stmt.Increment != nil {
+		r.expr(stmt.Increment)
+	}
+	r.stmt(stmt.Body)
+	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitForInStmt(stmt *ForIn) any {
+	r.expr(stmt.Iterable)
+	r.beginScope()
+	r.declare(stmt.Name, false)
+	r.stmt(stmt.Body)
+	r.endScope()
+	return nil
+}
+
+// The body runs in the same environment as the parameters.
+func (r *Resolver) VisitGeneratorStmt(stmt *Generator) any {
+	r.declare(stmt.Name, false)
+	r.beginScope()
+	for _, param := range stmt.Params {
+		r.declare(param, false)
+	}
+	r.statements(stmt.Body.(*Block).Statements)
+	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitIfStmt(stmt *If) any {
+	r.expr(stmt.Condition)
+	r.stmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.stmt(stmt.ElseBranch)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitImportStmt(stmt *Import) any {
+	r.declare(stmt.Name, false)
+	return nil
+}
+
+func (r *Resolver) VisitMatchStmt(stmt *Match) any {
+	r.expr(stmt.Subject)
+	for _, matchCase := range stmt.Cases {
+		for _, pattern := range matchCase.Patterns {
+			r.expr(pattern.Value)
+			if pattern.End != nil {
+				r.expr(pattern.End)
+			}
+		}
+		r.stmt(matchCase.Body)
+	}
+	if stmt.Default != nil {
+		r.stmt(stmt.Default)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitPrintStmt(stmt *Print) any {
+	r.expr(stmt.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitSelectStmt(stmt *Select) any {
+	for _, selectCase := range stmt.Cases {
+		r.expr(selectCase.Channel)
+		if selectCase.Value != nil {
+			r.expr(selectCase.Value)
+		}
+		if selectCase.Name.Lexeme == "" {
+			r.stmt(selectCase.Body)
+			continue
+		}
+		r.beginScope()
+		r.declare(selectCase.Name, false)
+		r.stmt(selectCase.Body)
+		r.endScope()
+	}
+	if stmt.Default != nil {
+		r.stmt(stmt.Default)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt *Throw) any {
+	r.expr(stmt.Value)
+	return nil
+}
+
+func (r *Resolver) VisitTryStmt(stmt *Try) any {
+	r.stmt(stmt.Body)
+	if stmt.CatchBody != nil {
+		r.beginScope()
+		r.declare(stmt.CatchName, false)
+		r.stmt(stmt.CatchBody)
+		r.endScope()
+	}
+	if stmt.FinallyBody != nil {
+		r.stmt(stmt.FinallyBody)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitVarStmt(stmt *Var) any {
+	if stmt.Initializer != nil {
+		r.expr(stmt.Initializer)
+	}
+	r.declare(stmt.Name, stmt.Keyword.Type == CONST)
+	return nil
+}
+
+func (r *Resolver) VisitWhileStmt(stmt *While) any {
+	r.expr(stmt.Condition)
+	r.stmt(stmt.Body)
+	return nil
+}
+
+func (r *Resolver) VisitYieldStmt(stmt *Yield) any {
+	r.expr(stmt.Value)
+	return nil
+}
+
+func (r *Resolver) VisitAssignExpr(expr *Assign) any {
+	r.expr(expr.Value)
+	binding, declaration := r.resolve(expr.Name)
+	if declaration != nil && declaration.Constant {
+		tokenErrorWithHint(expr.Name, "Cannot assign to constant '"+expr.Name.Lexeme+"'.", "Declare it with 'var' instead of 'const' to assign to it.")
+	}
+	expr.Binding = binding
+	return nil
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *Binary) any {
+	r.expr(expr.Left)
+	r.expr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitCallExpr(expr *Call) any {
+	r.expr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.expr(argument)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitConditionalExpr(expr *Conditional) any {
+	r.expr(expr.Condition)
+	r.expr(expr.ThenBranch)
+	r.expr(expr.ElseBranch)
+	return nil
+}
+
+func (r *Resolver) VisitGetExpr(expr *Get) any {
+	r.expr(expr.Object)
+	return nil
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *Grouping) any {
+	r.expr(expr.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitLambdaExpr(expr *Lambda) any {
+	r.stmt(expr.Body)
+	return nil
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *Literal) any {
+	return nil
+}
+
+func (r *Resolver) VisitLogicalExpr(expr *Logical) any {
+	r.expr(expr.Left)
+	r.expr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitRangeExpr(expr *Range) any {
+	r.expr(expr.Start)
+	r.expr(expr.End)
+	if expr.Step != nil {
+		r.expr(expr.Step)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitSpawnExpr(expr *Spawn) any {
+	r.stmt(expr.Body)
+	return nil
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *Unary) any {
+	r.expr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitVariableExpr(expr *Variable) any {
+	expr.Binding, _ = r.resolve(expr.Name)
+	return nil
+}
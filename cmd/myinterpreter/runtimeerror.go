@@ -1,6 +1,10 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 type RuntimeError struct {
 	Token   Token
@@ -8,5 +12,100 @@ type RuntimeError struct {
 }
 
 func (err RuntimeError) Error() string {
-	return fmt.Sprintf("%s\n[line %d]", err.Message, err.Token.Line)
+	return fmt.Sprintf("%s\n%s", err.Message, location(err.Token.File, err.Token.Line))
+}
+
+// Carries a value raised by a throw statement until a catch clause receives it.
+type ThrowError struct {
+	Token Token
+	Value Value
+}
+
+func (err ThrowError) Error() string {
+	return fmt.Sprintf("Uncaught exception: %s\n%s", err.Value, location(err.Token.File, err.Token.Line))
+}
+
+// The value a catch clause receives for a runtime error raised by the interpreter itself.
+type LoxError struct {
+	Message string
+	Line    int
+	File    string
+}
+
+func (e *LoxError) String() string {
+	return e.Message
+}
+
+func (e *LoxError) Type() string {
+	return "error"
+}
+
+// Turns an error into the value a catch clause receives. Halting is not an exception, so it cannot be caught.
+func caughtValue(err error) (Value, bool) {
+	var thrown ThrowError
+	if errors.As(err, &thrown) {
+		return thrown.Value, true
+	}
+	var runtimeErr RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return ObjectValue(&LoxError{runtimeErr.Message, runtimeErr.Token.Line, runtimeErr.Token.File}), true
+	}
+	return Nil, false
+}
+
+// Unwinds the program when it calls exit(). Like halting, it cannot be caught.
+type ExitError struct {
+	Code int
+}
+
+func (err ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", err.Code)
+}
+
+// Stops every task and timer once a call to exit() has unwound to the top of the task or program that made it, which
+// runs the finally clauses on the way, rather than halting everything as soon as it is called.
+func (r *Runtime) exited(err error) {
+	var exit ExitError
+	if errors.As(err, &exit) && r.stop != nil {
+		r.stop(exit)
+	}
+}
+
+// Finds the exit an error was caused by. Exiting also halts every other task, with the ExitError as the cause.
+func asExit(err error) (ExitError, bool) {
+	var exit ExitError
+	if errors.As(err, &exit) {
+		return exit, true
+	}
+	var halt HaltError
+	if errors.As(err, &halt) && errors.As(halt.Cause, &exit) {
+		return exit, true
+	}
+	return exit, false
+}
+
+var ErrStepLimit = errors.New("step limit exceeded")
+var ErrInterrupted = errors.New("interrupted")
+
+// Stops a program that was still correct but ran out of budget or was cancelled.
+// Token is the statement being started when the interpreter gave up.
+type HaltError struct {
+	Token Token
+	// ErrStepLimit, or the cause of the interpreter's context being done.
+	Cause error
+}
+
+func (err HaltError) Error() string {
+	var message string
+	switch {
+	case errors.Is(err.Cause, ErrInterrupted):
+		return "Interrupted at " + location(err.Token.File, err.Token.Line)
+	case errors.Is(err.Cause, ErrStepLimit):
+		message = "Step limit exceeded."
+	case errors.Is(err.Cause, context.DeadlineExceeded):
+		message = "Timed out."
+	default:
+		message = "Cancelled."
+	}
+	return fmt.Sprintf("Execution halted: %s\n%s", message, location(err.Token.File, err.Token.Line))
 }
@@ -2,45 +2,119 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"slices"
 	"strconv"
 )
 
 var keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
-	"false":  FALSE,
+	"and":     AND,
+	"catch":   CATCH,
+	"class":   CLASS,
+	"const":   CONST,
+	"else":    ELSE,
+	"export":  EXPORT,
+	"finally": FINALLY,
+	"for":     FOR,
+	"fun":     FUN,
+	"if":      IF,
+	"import":  IMPORT,
+	"nil":     NIL,
+	"or":      OR,
+	"print":   PRINT,
+	"return":  RETURN,
+	"super":   SUPER,
+	"this":    THIS,
+	"throw":   THROW,
+	"true":    TRUE,
+	"try":     TRY,
+	"var":     VAR,
+	"while":   WHILE,
+	"yield":   YIELD,
+	"false":   FALSE,
 }
 
+// Keywords kept for features the language does not have, which are never suggested.
+var reservedKeywords = []TokenType{CLASS, RETURN, SUPER, THIS}
+
+// The keywords that are values, which are suggested in place of names that are not defined.
+var valueKeywordNames = []string{"false", "nil", "true"}
+
+// The keywords that begin a statement, where the parser gets back in sync after an error.
+var statementKeywords = []TokenType{CLASS, FUN, VAR, CONST, FOR, IF, WHILE, PRINT, RETURN, THROW, TRY, YIELD, IMPORT, EXPORT}
+
+// Words that begin a statement only where the parser finds one, and are names everywhere else.
+var statementWords = []string{"match", "select"}
+
+// The statement keywords and words, sorted, for suggesting in place of a misspelled one.
+var statementKeywordNames = func() []string {
+	names := slices.DeleteFunc(sortedNames(keywords), func(name string) bool {
+		return !slices.Contains(statementKeywords, keywords[name]) || slices.Contains(reservedKeywords, keywords[name])
+	})
+	names = append(names, statementWords...)
+	slices.Sort(names)
+	return names
+}()
+
+// Reads tokens from its input one at a time, as the parser asks for them, so the whole source never has to be in
+// memory at once.
 type Scanner struct {
-	Source  string
-	Tokens  []Token
-	Start   int
-	Current int
-	Line    int
+	Reader   io.Reader
+	Comments []Comment
+	Line     int
+	// How many bytes of the current line have been read, and the column the token being scanned starts at.
+	column int
+	start  int
+	// Copied to every token, see Token.File.
+	File string
+	// Input read but not scanned yet is buffer[position:].
+	buffer   []byte
+	position int
+	// Set once Reader has nothing more to give.
+	readErr error
+	// The text of the token being scanned.
+	lexeme []byte
+	// The token scanToken found, if it found one rather than whitespace or a comment.
+	token   Token
+	scanned bool
 }
 
-func (s *Scanner) scanTokens() []Token {
+// Comments are kept out of the token stream so that only tools like the formatter see them.
+type Comment struct {
+	// The comment text, including the leading "//".
+	Text string
+	Line int
+}
+
+func NewScanner(reader io.Reader, file string) *Scanner {
+	return &Scanner{Reader: recordSource(reader, file), Line: 1, File: file}
+}
+
+// Returns the next token, or an EOF token once the input is exhausted, for as many calls as are made after that.
+// Errors reading the input are reported like scanning errors and end the input.
+func (s *Scanner) NextToken() Token {
 	for !s.isAtEnd() {
-		s.Start = s.Current
+		s.lexeme = s.lexeme[:0]
+		s.start = s.column + 1
+		s.scanned = false
 		s.scanToken()
+		if s.scanned {
+			return s.token
+		}
 	}
+	return Token{EOF, "", nil, s.Line, s.column + 1, s.File}
+}
 
-	s.Tokens = append(s.Tokens, Token{EOF, "", nil, s.Line})
-
-	return s.Tokens
+// Scans the rest of the input.
+func (s *Scanner) scanTokens() []Token {
+	tokens := []Token{}
+	for {
+		token := s.NextToken()
+		tokens = append(tokens, token)
+		if token.Type == EOF {
+			return tokens
+		}
+	}
 }
 
 func (s *Scanner) scanToken() {
@@ -56,8 +130,6 @@ func (s *Scanner) scanToken() {
 		s.addToken(RIGHT_BRACE)
 	case ',':
 		s.addToken(COMMA)
-	case '.':
-		s.addToken(DOT)
 	case '-':
 		s.addToken(MINUS)
 	case '+':
@@ -66,6 +138,8 @@ func (s *Scanner) scanToken() {
 		s.addToken(SEMICOLON)
 	case '*':
 		s.addToken(STAR)
+	case ':':
+		s.addToken(COLON)
 
 	case '!':
 		if s.match('=') {
@@ -91,12 +165,21 @@ func (s *Scanner) scanToken() {
 		} else {
 			s.addToken(GREATER)
 		}
+	case '.':
+		s.addToken(DOT)
+	case '?':
+		if s.match('?') {
+			s.addToken(QUESTION_QUESTION)
+		} else {
+			s.addToken(QUESTION)
+		}
 	// Handle comments.
 	case '/':
 		if s.match('/') {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.Comments = append(s.Comments, Comment{string(s.lexeme), s.Line})
 		} else {
 			s.addToken(SLASH)
 		}
@@ -113,7 +196,7 @@ func (s *Scanner) scanToken() {
 		} else if isAlpha(c) {
 			s.identifier()
 		} else {
-			lineError(s.Line, fmt.Sprintf("Unexpected character: %c", c))
+			s.error(fmt.Sprintf("Unexpected character: %c", c), "")
 		}
 	}
 }
@@ -123,8 +206,7 @@ func (s *Scanner) identifier() {
 		s.advance()
 	}
 
-	text := s.Source[s.Start:s.Current]
-	tokenType, ok := keywords[text]
+	tokenType, ok := keywords[string(s.lexeme)]
 	if !ok {
 		tokenType = IDENTIFIER
 	}
@@ -145,7 +227,7 @@ func (s *Scanner) number() {
 		}
 	}
 
-	literal, _ := strconv.ParseFloat(s.Source[s.Start:s.Current], 64)
+	literal, _ := strconv.ParseFloat(string(s.lexeme), 64)
 	s.addTokenWithLiteral(NUMBER, literal)
 }
 
@@ -158,38 +240,63 @@ func (s *Scanner) string() {
 	}
 
 	if s.isAtEnd() {
-		lineError(s.Line, "Unterminated string.")
+		s.error("Unterminated string.", "Strings end with '\"'. They can span lines.")
 		return
 	}
 
 	s.advance()
 
-	s.addTokenWithLiteral(STRING, s.Source[s.Start+1:s.Current-1])
+	s.addTokenWithLiteral(STRING, string(s.lexeme[1:len(s.lexeme)-1]))
 }
 
 func (s *Scanner) match(expected byte) bool {
-	if s.isAtEnd() {
-		return false
-	}
-	if s.Source[s.Current] != expected {
+	if s.peek() != expected {
 		return false
 	}
-	s.Current++
+	s.advance()
 	return true
 }
 
 func (s *Scanner) peek() byte {
-	if s.isAtEnd() {
-		return '\000'
-	}
-	return s.Source[s.Current]
+	return s.peekAt(0)
 }
 
 func (s *Scanner) peekNext() byte {
-	if s.Current+1 >= len(s.Source) {
+	return s.peekAt(1)
+}
+
+func (s *Scanner) peekAt(offset int) byte {
+	if s.position+offset >= len(s.buffer) && !s.fill(offset+1) {
 		return '\000'
 	}
-	return s.Source[s.Current+1]
+	return s.buffer[s.position+offset]
+}
+
+// How much input is read from Reader at a time.
+const scanChunk = 64 * 1024
+
+// Reads until at least n bytes are left to scan, reporting false if the input ends first.
+func (s *Scanner) fill(n int) bool {
+	for len(s.buffer)-s.position < n {
+		if s.readErr != nil {
+			return false
+		}
+		// Move what is left to the front and make room for another chunk behind it.
+		left := copy(s.buffer, s.buffer[s.position:])
+		s.buffer, s.position = s.buffer[:left], 0
+		if cap(s.buffer)-left < scanChunk {
+			s.buffer = append(make([]byte, 0, left+scanChunk), s.buffer...)
+		}
+		read, err := s.Reader.Read(s.buffer[left : left+scanChunk])
+		s.buffer = s.buffer[:left+read]
+		if err == io.EOF {
+			s.readErr = err
+		} else if err != nil {
+			s.readErr = err
+			lineError(s.File, s.Line, "Error reading source: "+err.Error())
+		}
+	}
+	return true
 }
 
 func isAlpha(c byte) bool {
@@ -205,12 +312,24 @@ func isDigit(c byte) bool {
 }
 
 func (s *Scanner) isAtEnd() bool {
-	return s.Current >= len(s.Source)
+	return s.position >= len(s.buffer) && !s.fill(1)
 }
 
 func (s *Scanner) advance() byte {
-	s.Current++
-	return s.Source[s.Current-1]
+	c := s.peek()
+	s.position++
+	s.lexeme = append(s.lexeme, c)
+	if c == '\n' {
+		s.column = 0
+	} else {
+		s.column++
+	}
+	return c
+}
+
+// Reports an error in the token being scanned.
+func (s *Scanner) error(message, hint string) {
+	report(Token{Lexeme: string(s.lexeme), Line: s.Line, Column: s.start, File: s.File}, "", message, hint)
 }
 
 func (s *Scanner) addToken(tokenType TokenType) {
@@ -218,6 +337,6 @@ func (s *Scanner) addToken(tokenType TokenType) {
 }
 
 func (s *Scanner) addTokenWithLiteral(tokenType TokenType, literal interface{}) {
-	text := s.Source[s.Start:s.Current]
-	s.Tokens = append(s.Tokens, Token{tokenType, text, literal, s.Line})
+	s.token = Token{tokenType, string(s.lexeme), literal, s.Line, s.start, s.File}
+	s.scanned = true
 }
@@ -2,66 +2,252 @@ package main
 
 type Stmt interface {
 	Accept(visitor StmtVisitor) any
+	NodeId() int
 }
 
 type StmtVisitor interface {
-	VisitBlockStmt(stmt Block) any
-	VisitExpressionStmt(stmt Expression) any
-	VisitIfStmt(stmt If) any
-	VisitPrintStmt(stmt Print) any
-	VisitVarStmt(stmt Var) any
-	VisitWhileStmt(stmt While) any
+	VisitBlockStmt(stmt *Block) any
+	VisitExportStmt(stmt *Export) any
+	VisitExpressionStmt(stmt *Expression) any
+	VisitForStmt(stmt *For) any
+	VisitForInStmt(stmt *ForIn) any
+	VisitGeneratorStmt(stmt *Generator) any
+	VisitIfStmt(stmt *If) any
+	VisitImportStmt(stmt *Import) any
+	VisitMatchStmt(stmt *Match) any
+	VisitPrintStmt(stmt *Print) any
+	VisitSelectStmt(stmt *Select) any
+	VisitThrowStmt(stmt *Throw) any
+	VisitTryStmt(stmt *Try) any
+	VisitVarStmt(stmt *Var) any
+	VisitWhileStmt(stmt *While) any
+	VisitYieldStmt(stmt *Yield) any
+}
+
+type TypedStmtVisitor[T any] interface {
+	VisitBlockStmt(stmt *Block) T
+	VisitExportStmt(stmt *Export) T
+	VisitExpressionStmt(stmt *Expression) T
+	VisitForStmt(stmt *For) T
+	VisitForInStmt(stmt *ForIn) T
+	VisitGeneratorStmt(stmt *Generator) T
+	VisitIfStmt(stmt *If) T
+	VisitImportStmt(stmt *Import) T
+	VisitMatchStmt(stmt *Match) T
+	VisitPrintStmt(stmt *Print) T
+	VisitSelectStmt(stmt *Select) T
+	VisitThrowStmt(stmt *Throw) T
+	VisitTryStmt(stmt *Try) T
+	VisitVarStmt(stmt *Var) T
+	VisitWhileStmt(stmt *While) T
+	VisitYieldStmt(stmt *Yield) T
+}
+
+func AcceptStmt[T any](stmt Stmt, visitor TypedStmtVisitor[T]) T {
+	switch t := stmt.(type) {
+	case *Block:
+		return visitor.VisitBlockStmt(t)
+	case *Export:
+		return visitor.VisitExportStmt(t)
+	case *Expression:
+		return visitor.VisitExpressionStmt(t)
+	case *For:
+		return visitor.VisitForStmt(t)
+	case *ForIn:
+		return visitor.VisitForInStmt(t)
+	case *Generator:
+		return visitor.VisitGeneratorStmt(t)
+	case *If:
+		return visitor.VisitIfStmt(t)
+	case *Import:
+		return visitor.VisitImportStmt(t)
+	case *Match:
+		return visitor.VisitMatchStmt(t)
+	case *Print:
+		return visitor.VisitPrintStmt(t)
+	case *Select:
+		return visitor.VisitSelectStmt(t)
+	case *Throw:
+		return visitor.VisitThrowStmt(t)
+	case *Try:
+		return visitor.VisitTryStmt(t)
+	case *Var:
+		return visitor.VisitVarStmt(t)
+	case *While:
+		return visitor.VisitWhileStmt(t)
+	case *Yield:
+		return visitor.VisitYieldStmt(t)
+	}
+	panic("unknown Stmt")
 }
 
 type Block struct {
+	Node
 	Statements []Stmt
 }
 
-func (t Block) Accept(visitor StmtVisitor) any {
+func (t *Block) Accept(visitor StmtVisitor) any {
 	return visitor.VisitBlockStmt(t)
 }
 
+type Export struct {
+	Node
+	Keyword Token
+	Declaration Stmt
+}
+
+func (t *Export) Accept(visitor StmtVisitor) any {
+	return visitor.VisitExportStmt(t)
+}
+
 type Expression struct {
+	Node
 	Expression Expr
 }
 
-func (t Expression) Accept(visitor StmtVisitor) any {
+func (t *Expression) Accept(visitor StmtVisitor) any {
 	return visitor.VisitExpressionStmt(t)
 }
 
+type For struct {
+	Node
+	Initializer Stmt
+	Condition Expr
+	Increment Expr
+	Body Stmt
+}
+
+func (t *For) Accept(visitor StmtVisitor) any {
+	return visitor.VisitForStmt(t)
+}
+
+type ForIn struct {
+	Node
+	Name Token
+	In Token
+	Iterable Expr
+	Body Stmt
+}
+
+func (t *ForIn) Accept(visitor StmtVisitor) any {
+	return visitor.VisitForInStmt(t)
+}
+
+type Generator struct {
+	Node
+	Name Token
+	Params []Token
+	Body Stmt
+}
+
+func (t *Generator) Accept(visitor StmtVisitor) any {
+	return visitor.VisitGeneratorStmt(t)
+}
+
 type If struct {
+	Node
 	Condition Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
 }
 
-func (t If) Accept(visitor StmtVisitor) any {
+func (t *If) Accept(visitor StmtVisitor) any {
 	return visitor.VisitIfStmt(t)
 }
 
+type Import struct {
+	Node
+	Keyword Token
+	Path Token
+	Name Token
+}
+
+func (t *Import) Accept(visitor StmtVisitor) any {
+	return visitor.VisitImportStmt(t)
+}
+
+type Match struct {
+	Node
+	Keyword Token
+	Subject Expr
+	Cases []MatchCase
+	Default Stmt
+}
+
+func (t *Match) Accept(visitor StmtVisitor) any {
+	return visitor.VisitMatchStmt(t)
+}
+
 type Print struct {
+	Node
 	Expression Expr
 }
 
-func (t Print) Accept(visitor StmtVisitor) any {
+func (t *Print) Accept(visitor StmtVisitor) any {
 	return visitor.VisitPrintStmt(t)
 }
 
+type Select struct {
+	Node
+	Keyword Token
+	Cases []SelectCase
+	Default Stmt
+}
+
+func (t *Select) Accept(visitor StmtVisitor) any {
+	return visitor.VisitSelectStmt(t)
+}
+
+type Throw struct {
+	Node
+	Keyword Token
+	Value Expr
+}
+
+func (t *Throw) Accept(visitor StmtVisitor) any {
+	return visitor.VisitThrowStmt(t)
+}
+
+type Try struct {
+	Node
+	Body Stmt
+	CatchName Token
+	CatchBody Stmt
+	FinallyBody Stmt
+}
+
+func (t *Try) Accept(visitor StmtVisitor) any {
+	return visitor.VisitTryStmt(t)
+}
+
 type Var struct {
+	Node
+	Keyword Token
 	Name Token
 	Initializer Expr
 }
 
-func (t Var) Accept(visitor StmtVisitor) any {
+func (t *Var) Accept(visitor StmtVisitor) any {
 	return visitor.VisitVarStmt(t)
 }
 
 type While struct {
+	Node
 	Condition Expr
 	Body Stmt
 }
 
-func (t While) Accept(visitor StmtVisitor) any {
+func (t *While) Accept(visitor StmtVisitor) any {
 	return visitor.VisitWhileStmt(t)
 }
 
+type Yield struct {
+	Node
+	Keyword Token
+	Value Expr
+}
+
+func (t *Yield) Accept(visitor StmtVisitor) any {
+	return visitor.VisitYieldStmt(t)
+}
+
@@ -19,6 +19,8 @@ const (
 	SEMICOLON
 	SLASH
 	STAR
+	COLON
+	QUESTION
 
 	// One or two character tokens.
 	BANG
@@ -29,6 +31,11 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	QUESTION_QUESTION
+
+	// Range operators, which the parser forms from the dots and less-than sign they are written with.
+	DOT_DOT
+	DOT_DOT_LESS
 
 	// Literals.
 	IDENTIFIER
@@ -37,65 +44,86 @@ const (
 
 	// Keywords.
 	AND
+	CATCH
 	CLASS
+	CONST
 	ELSE
+	EXPORT
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
+	YIELD
 
 	EOF
 )
 
 var tokenNames = map[TokenType]string{
-	LEFT_PAREN:    "LEFT_PAREN",
-	RIGHT_PAREN:   "RIGHT_PAREN",
-	LEFT_BRACE:    "LEFT_BRACE",
-	RIGHT_BRACE:   "RIGHT_BRACE",
-	COMMA:         "COMMA",
-	DOT:           "DOT",
-	MINUS:         "MINUS",
-	PLUS:          "PLUS",
-	SEMICOLON:     "SEMICOLON",
-	SLASH:         "SLASH",
-	STAR:          "STAR",
-	BANG:          "BANG",
-	BANG_EQUAL:    "BANG_EQUAL",
-	EQUAL:         "EQUAL",
-	EQUAL_EQUAL:   "EQUAL_EQUAL",
-	GREATER:       "GREATER",
-	GREATER_EQUAL: "GREATER_EQUAL",
-	LESS:          "LESS",
-	LESS_EQUAL:    "LESS_EQUAL",
-	IDENTIFIER:    "IDENTIFIER",
-	STRING:        "STRING",
-	NUMBER:        "NUMBER",
-	AND:           "AND",
-	CLASS:         "CLASS",
-	ELSE:          "ELSE",
-	FALSE:         "FALSE",
-	FUN:           "FUN",
-	FOR:           "FOR",
-	IF:            "IF",
-	NIL:           "NIL",
-	OR:            "OR",
-	PRINT:         "PRINT",
-	RETURN:        "RETURN",
-	SUPER:         "SUPER",
-	THIS:          "THIS",
-	TRUE:          "TRUE",
-	VAR:           "VAR",
-	WHILE:         "WHILE",
-	EOF:           "EOF",
+	LEFT_PAREN:        "LEFT_PAREN",
+	RIGHT_PAREN:       "RIGHT_PAREN",
+	LEFT_BRACE:        "LEFT_BRACE",
+	RIGHT_BRACE:       "RIGHT_BRACE",
+	COMMA:             "COMMA",
+	DOT:               "DOT",
+	MINUS:             "MINUS",
+	PLUS:              "PLUS",
+	SEMICOLON:         "SEMICOLON",
+	SLASH:             "SLASH",
+	STAR:              "STAR",
+	COLON:             "COLON",
+	QUESTION:          "QUESTION",
+	BANG:              "BANG",
+	BANG_EQUAL:        "BANG_EQUAL",
+	EQUAL:             "EQUAL",
+	EQUAL_EQUAL:       "EQUAL_EQUAL",
+	GREATER:           "GREATER",
+	GREATER_EQUAL:     "GREATER_EQUAL",
+	LESS:              "LESS",
+	LESS_EQUAL:        "LESS_EQUAL",
+	QUESTION_QUESTION: "QUESTION_QUESTION",
+	DOT_DOT:           "DOT_DOT",
+	DOT_DOT_LESS:      "DOT_DOT_LESS",
+	IDENTIFIER:        "IDENTIFIER",
+	STRING:            "STRING",
+	NUMBER:            "NUMBER",
+	AND:               "AND",
+	CATCH:             "CATCH",
+	CLASS:             "CLASS",
+	CONST:             "CONST",
+	ELSE:              "ELSE",
+	EXPORT:            "EXPORT",
+	FALSE:             "FALSE",
+	FINALLY:           "FINALLY",
+	FUN:               "FUN",
+	FOR:               "FOR",
+	IF:                "IF",
+	IMPORT:            "IMPORT",
+	NIL:               "NIL",
+	OR:                "OR",
+	PRINT:             "PRINT",
+	RETURN:            "RETURN",
+	SUPER:             "SUPER",
+	THIS:              "THIS",
+	THROW:             "THROW",
+	TRUE:              "TRUE",
+	TRY:               "TRY",
+	VAR:               "VAR",
+	WHILE:             "WHILE",
+	YIELD:             "YIELD",
+	EOF:               "EOF",
 }
 
 type Token struct {
@@ -103,6 +131,10 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	// Where the token starts on its line, counting bytes from 1. Zero for tokens that were not scanned.
+	Column int
+	// The file the token was read from, as shown in diagnostics. Empty for the main file.
+	File string
 }
 
 func (t Token) String() string {
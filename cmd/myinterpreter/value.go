@@ -0,0 +1,178 @@
+package main
+
+import "fmt"
+
+// The kinds of value a program can compute with.
+type Kind uint8
+
+const (
+	NilKind Kind = iota
+	BoolKind
+	NumberKind
+	StringKind
+	// Everything else: functions, generators, tasks, channels, modules, ranges, lists and errors.
+	ObjectKind
+)
+
+// Implemented by every runtime value that is not nil, a boolean, a number or a string.
+type Object interface {
+	// The name of the type, as shown in error messages.
+	Type() string
+	String() string
+}
+
+// A runtime value. The zero value is nil.
+type Value struct {
+	kind Kind
+	// Numbers, and booleans as 0 or 1.
+	number float64
+	// Strings and objects.
+	ref any
+}
+
+var Nil = Value{}
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{kind: BoolKind, number: 1}
+	}
+	return Value{kind: BoolKind}
+}
+
+func NumberValue(n float64) Value {
+	return Value{kind: NumberKind, number: n}
+}
+
+func StringValue(s string) Value {
+	return Value{kind: StringKind, ref: s}
+}
+
+func ObjectValue(o Object) Value {
+	if o == nil {
+		return Nil
+	}
+	return Value{kind: ObjectKind, ref: o}
+}
+
+// Converts the Go value of a literal, as the scanner and the optimizer produce them.
+func valueOf(literal any) Value {
+	switch l := literal.(type) {
+	case nil:
+		return Nil
+	case bool:
+		return BoolValue(l)
+	case float64:
+		return NumberValue(l)
+	case string:
+		return StringValue(l)
+	case Value:
+		return l
+	case Object:
+		return ObjectValue(l)
+	}
+	panic(fmt.Sprintf("no value for literal %v (%T)", literal, literal))
+}
+
+// The Go value of v, the inverse of valueOf.
+func (v Value) Interface() any {
+	switch v.kind {
+	case BoolKind:
+		return v.number != 0
+	case NumberKind:
+		return v.number
+	case StringKind, ObjectKind:
+		return v.ref
+	}
+	return nil
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+func (v Value) IsNil() bool {
+	return v.kind == NilKind
+}
+
+func (v Value) IsNumber() bool {
+	return v.kind == NumberKind
+}
+
+func (v Value) IsString() bool {
+	return v.kind == StringKind
+}
+
+// The number v holds, or zero if it is not a number.
+func (v Value) AsNumber() float64 {
+	if v.kind != NumberKind {
+		return 0
+	}
+	return v.number
+}
+
+// The string v holds, or "" if it is not a string.
+func (v Value) AsString() string {
+	s, _ := v.ref.(string)
+	return s
+}
+
+// The object v holds, or nil if it is not an object.
+func (v Value) AsObject() Object {
+	o, _ := v.ref.(Object)
+	return o
+}
+
+func (v Value) Type() string {
+	switch v.kind {
+	case BoolKind:
+		return "boolean"
+	case NumberKind:
+		return "number"
+	case StringKind:
+		return "string"
+	case ObjectKind:
+		return v.AsObject().Type()
+	}
+	return "nil"
+}
+
+// Only nil and false are falsey.
+func (v Value) Truthy() bool {
+	switch v.kind {
+	case NilKind:
+		return false
+	case BoolKind:
+		return v.number != 0
+	}
+	return true
+}
+
+// Values of different kinds are never equal. Objects are equal only to themselves, apart from ranges, which are equal
+// when they visit the same numbers.
+func (v Value) Equals(other Value) bool {
+	if v.kind != other.kind {
+		return false
+	}
+	switch v.kind {
+	case NilKind:
+		return true
+	case BoolKind, NumberKind:
+		return v.number == other.number
+	}
+	return v.ref == other.ref
+}
+
+// The text print shows for v.
+func (v Value) String() string {
+	switch v.kind {
+	case BoolKind:
+		return fmt.Sprint(v.number != 0)
+	case NumberKind:
+		return stringifyNumber(v.number, false)
+	case StringKind:
+		return v.AsString()
+	case ObjectKind:
+		return v.AsObject().String()
+	}
+	return "nil"
+}
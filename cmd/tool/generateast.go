@@ -13,21 +13,37 @@ func main() {
 	}
 	outputDir := os.Args[1]
 	defineAst(outputDir, "Expr", []string{
-		"Assign   : Name Token, Value Expr",
+		"Assign   : Name Token, Value Expr, Binding Binding",
 		"Binary   : Left Expr, Operator Token, Right Expr",
+		"Call     : Callee Expr, Paren Token, Arguments []Expr",
+		"Conditional : Condition Expr, Operator Token, ThenBranch Expr, ElseBranch Expr",
+		"Get      : Object Expr, Name Token",
 		"Grouping : Expression Expr",
-		"Literal  : Value any",
+		"Lambda   : Body Stmt",
+		"Literal  : Value any, Token Token",
 		"Logical  : Left Expr, Operator Token, Right Expr",
+		"Range    : Start Expr, Operator Token, End Expr, Step Expr",
+		"Spawn    : Keyword Token, Body Stmt",
 		"Unary    : Operator Token, Right Expr",
-		"Variable : Name Token",
+		"Variable : Name Token, Binding Binding",
 	})
 	defineAst(outputDir, "Stmt", []string{
 		"Block      : Statements []Stmt",
+		"Export     : Keyword Token, Declaration Stmt",
 		"Expression : Expression Expr",
+		"For        : Initializer Stmt, Condition Expr, Increment Expr, Body Stmt",
+		"ForIn      : Name Token, In Token, Iterable Expr, Body Stmt",
+		"Generator  : Name Token, Params []Token, Body Stmt",
 		"If         : Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
+		"Import     : Keyword Token, Path Token, Name Token",
+		"Match      : Keyword Token, Subject Expr, Cases []MatchCase, Default Stmt",
 		"Print      : Expression Expr",
-		"Var        : Name Token, Initializer Expr",
+		"Select     : Keyword Token, Cases []SelectCase, Default Stmt",
+		"Throw      : Keyword Token, Value Expr",
+		"Try        : Body Stmt, CatchName Token, CatchBody Stmt, FinallyBody Stmt",
+		"Var        : Keyword Token, Name Token, Initializer Expr",
 		"While      : Condition Expr, Body Stmt",
+		"Yield      : Keyword Token, Value Expr",
 	})
 }
 
@@ -42,9 +58,11 @@ func defineAst(outputDir, baseName string, types []string) {
 	file.WriteString("package main\n\n")
 	file.WriteString("type " + baseName + " interface {\n")
 	file.WriteString("\tAccept(visitor " + baseName + "Visitor) any\n")
+	file.WriteString("\tNodeId() int\n")
 	file.WriteString("}\n\n")
 
 	defineVisitor(file, baseName, types)
+	defineTypedVisitor(file, baseName, types)
 
 	for _, t := range types {
 		className := strings.TrimSpace(strings.Split(t, ":")[0])
@@ -57,19 +75,41 @@ func defineVisitor(file *os.File, baseName string, types []string) {
 	file.WriteString("type " + baseName + "Visitor interface {\n")
 	for _, t := range types {
 		typeName := strings.TrimSpace(strings.Split(t, ":")[0])
-		file.WriteString("\tVisit" + typeName + baseName + "(" + strings.ToLower(baseName) + " " + typeName + ") any\n")
+		file.WriteString("\tVisit" + typeName + baseName + "(" + strings.ToLower(baseName) + " *" + typeName + ") any\n")
 	}
 	file.WriteString("}\n\n")
 }
 
+// Visitors whose results all have the same type can be dispatched to without boxing them in an any.
+func defineTypedVisitor(file *os.File, baseName string, types []string) {
+	file.WriteString("type Typed" + baseName + "Visitor[T any] interface {\n")
+	for _, t := range types {
+		typeName := strings.TrimSpace(strings.Split(t, ":")[0])
+		file.WriteString("\tVisit" + typeName + baseName + "(" + strings.ToLower(baseName) + " *" + typeName + ") T\n")
+	}
+	file.WriteString("}\n\n")
+
+	file.WriteString("func Accept" + baseName + "[T any](" + strings.ToLower(baseName) + " " + baseName + ", visitor Typed" + baseName + "Visitor[T]) T {\n")
+	file.WriteString("\tswitch t := " + strings.ToLower(baseName) + ".(type) {\n")
+	for _, t := range types {
+		typeName := strings.TrimSpace(strings.Split(t, ":")[0])
+		file.WriteString("\tcase *" + typeName + ":\n")
+		file.WriteString("\t\treturn visitor.Visit" + typeName + baseName + "(t)\n")
+	}
+	file.WriteString("\t}\n")
+	file.WriteString("\tpanic(\"unknown " + baseName + "\")\n")
+	file.WriteString("}\n\n")
+}
+
 func defineType(file *os.File, baseName, className, fields string) {
 	file.WriteString("type " + className + " struct {\n")
+	file.WriteString("\tNode\n")
 	for _, field := range strings.Split(fields, ", ") {
 		file.WriteString("\t" + field + "\n")
 	}
 	file.WriteString("}\n\n")
 
-	file.WriteString("func (t " + className + ") Accept(visitor " + baseName + "Visitor) any {\n")
+	file.WriteString("func (t *" + className + ") Accept(visitor " + baseName + "Visitor) any {\n")
 	file.WriteString("\treturn visitor.Visit" + className + baseName + "(t)\n")
 	file.WriteString("}\n\n")
 }